@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client calls the REST API of a natgb server.
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(server, token string) *client {
+	return &client{
+		server: strings.TrimSuffix(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// do sends a request to a path under /api/v1 and returns the response body.
+// Error responses are returned as errors with the server's message.
+func (c *client) do(method, path string, query url.Values, body io.Reader, contentType string) ([]byte, error) {
+	target := c.server + "/api/v1" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", c.server, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &apiError{status: resp.StatusCode, message: strings.TrimSpace(string(data))}
+		if apiErr.message == "" {
+			apiErr.message = http.StatusText(resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && c.token == "" {
+			apiErr.message += " (set a token with -token, $NAT_TOKEN or nat config)"
+		}
+		return nil, apiErr
+	}
+
+	return data, nil
+}
+
+// apiError is an error response of the server.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// call sends in as JSON, if not nil, and decodes the response into out, if
+// not nil.
+func (c *client) call(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	data, err := c.do(method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+func escape(segment string) string {
+	return url.PathEscape(segment)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// settings are the defaults saved by "nat config".
+type settings struct {
+	Server string `json:"server,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// settingsPath is the settings file, in the user's configuration directory.
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "nat", "config.json"), nil
+}
+
+// loadSettings reads the saved settings, which may not exist yet.
+func loadSettings() (*settings, error) {
+	path, err := settingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &settings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	var saved settings
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to read settings %s: %w", path, err)
+	}
+	return &saved, nil
+}
+
+// saveSettings writes the settings, readable by the user alone since they
+// hold the token.
+func saveSettings(saved *settings) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
+// configure saves the -server and -token given, or shows the settings in
+// effect. Tokens are never printed in full.
+func configure(app *app, name string, args []string) error {
+	if _, err := parse(app.flags(name), args, 0, 0, "[-server URL] [-token TOKEN]"); err != nil {
+		return err
+	}
+
+	saved, err := loadSettings()
+	if err != nil {
+		return err
+	}
+
+	if app.options.server != "" || app.options.token != "" {
+		if app.options.server != "" {
+			saved.Server = app.options.server
+		}
+		if app.options.token != "" {
+			saved.Token = app.options.token
+		}
+		if err := saveSettings(saved); err != nil {
+			return err
+		}
+	}
+
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+
+	shown := map[string]string{"server": api.server, "token": maskToken(api.token), "file": path}
+	return app.print(shown, func(w *tabwriter.Writer) {
+		row(w, "Server:", shown["server"])
+		row(w, "Token:", shown["token"])
+		row(w, "Settings:", shown["file"])
+	})
+}
+
+// maskToken keeps enough of a token to tell tokens apart.
+func maskToken(token string) string {
+	switch {
+	case token == "":
+		return "(none)"
+	case len(token) <= 8:
+		return "********"
+	}
+	return token[:4] + "…" + token[len(token)-4:]
+}
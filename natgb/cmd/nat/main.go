@@ -0,0 +1,215 @@
+// ============================================================================
+// nat - command-line client for the natgb REST API
+// ============================================================================
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Usage: nat <command> [flags] [arguments]
+
+Workspaces:
+  workspaces                          List workspaces
+  workspace create NAME               Create a workspace
+  workspace show ID                   Show a workspace with its blocks and notes
+  workspace rename ID NAME            Rename a workspace
+  workspace delete ID                 Delete a workspace
+
+Note blocks:
+  blocks WORKSPACE                    List the note blocks of a workspace
+  block create WORKSPACE HEAD         Create a note block
+  block rename ID HEAD                Rename a note block
+  block delete ID                     Delete a note block
+
+Notes:
+  notes WORKSPACE                     List notes; -block, -priority, -status, -tag,
+                                      -completed, -q, -sort and -limit filter them
+  note create BLOCK HEAD              Create a note; -note, -priority, -status,
+                                      -tag and -due set its fields
+  note show ID                        Show a note
+  note update ID                      Change the fields given as flags, and -head
+  note toggle ID                      Toggle completion
+  note delete ID                      Delete a note
+
+Files:
+  export [WORKSPACE]                  Export to -o or standard output; -format is
+                                      json, md, csv, txt or ics for a workspace,
+                                      json, csv or zip for all of them
+  import [WORKSPACE] FILE             Import a file; -format is md, csv or txt into
+                                      a workspace, json, zip or trello otherwise,
+                                      by default from the file extension
+
+Settings:
+  config                              Show the settings, or save -server and -token
+
+Every command takes -server, -token and -json, which prints JSON instead of
+tables. The server and token default to $NAT_SERVER and $NAT_TOKEN, then to
+the saved settings, and the server to http://localhost:8080.
+`
+
+// options are the flags every command takes.
+type options struct {
+	server string
+	token  string
+	json   bool
+}
+
+// command runs with the arguments after its name, which is given for
+// app.flags.
+type command func(app *app, name string, args []string) error
+
+var commands = map[string]command{
+	"workspaces": listWorkspaces,
+	"workspace":  subcommands(map[string]command{"create": createWorkspace, "show": showWorkspace, "rename": renameWorkspace, "delete": deleteWorkspace}),
+	"blocks":     listNoteBlocks,
+	"block":      subcommands(map[string]command{"create": createNoteBlock, "rename": renameNoteBlock, "delete": deleteNoteBlock}),
+	"notes":      listNotes,
+	"note":       subcommands(map[string]command{"create": createNote, "show": showNote, "update": updateNote, "toggle": toggleNote, "delete": deleteNote}),
+	"export":     exportFile,
+	"import":     importFile,
+	"config":     configure,
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "nat: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	app := &app{out: os.Stdout}
+	if err := run(app, "nat "+os.Args[1], os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "nat: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// subcommands dispatches on the first argument.
+func subcommands(run map[string]command) command {
+	return func(app *app, name string, args []string) error {
+		sub, ok := run[""]
+		if len(args) > 0 {
+			sub, ok = run[args[0]]
+		}
+		if !ok {
+			names := make([]string, 0, len(run))
+			for sub := range run {
+				names = append(names, sub)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("usage: %s %s ..., see nat help", name, strings.Join(names, "|"))
+		}
+		return sub(app, name+" "+args[0], args[1:])
+	}
+}
+
+// parse parses flags placed before, between or after the arguments and
+// checks the number of arguments, between min and max.
+func parse(fs *flag.FlagSet, args []string, min, max int, names string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < min || len(positional) > max {
+		return nil, fmt.Errorf("usage: %s %s", fs.Name(), names)
+	}
+	return positional, nil
+}
+
+// ============================================================================
+// Output
+// ============================================================================
+
+// app holds what commands share: the options, the output and the client,
+// which is set up once the flags are parsed.
+type app struct {
+	options options
+	out     io.Writer
+	api     *client
+}
+
+// flags returns the flag set of a command with the common flags.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&a.options.server, "server", "", "server URL")
+	fs.StringVar(&a.options.token, "token", "", "API token")
+	fs.BoolVar(&a.options.json, "json", false, "print JSON")
+	return fs
+}
+
+// client returns the API client for the parsed options.
+func (a *app) client() (*client, error) {
+	if a.api == nil {
+		settings, err := loadSettings()
+		if err != nil {
+			return nil, err
+		}
+		server := firstOf(a.options.server, os.Getenv("NAT_SERVER"), settings.Server, defaultServer)
+		token := firstOf(a.options.token, os.Getenv("NAT_TOKEN"), settings.Token)
+		a.api = newClient(server, token)
+	}
+	return a.api, nil
+}
+
+// print writes a value as indented JSON with -json, or else as a table.
+func (a *app) print(value interface{}, table func(w *tabwriter.Writer)) error {
+	if a.options.json {
+		encoder := json.NewEncoder(a.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes a table row of tab separated cells.
+func row(w io.Writer, cells ...interface{}) {
+	text := make([]string, len(cells))
+	for i, cell := range cells {
+		// Tabs and line breaks would break the table
+		text[i] = strings.Join(strings.Fields(fmt.Sprint(cell)), " ")
+	}
+	fmt.Fprintln(w, strings.Join(text, "\t"))
+}
+
+// message writes a line of text.
+func message(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
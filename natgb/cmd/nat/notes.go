@@ -0,0 +1,335 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// noteRow is the table row of a note.
+func noteRow(note models.Note) []interface{} {
+	done := "[ ]"
+	if note.Metadata.Completed != nil && *note.Metadata.Completed {
+		done = "[x]"
+	}
+	due := ""
+	if note.Metadata.Due != nil {
+		due = formatDue(*note.Metadata.Due)
+	}
+	return []interface{}{note.ID, done, note.Priority, note.Status, due, note.Head, strings.Join(note.Tags, ",")}
+}
+
+// formatDue leaves out the time of due dates at midnight.
+func formatDue(due time.Time) string {
+	due = due.Local()
+	if due.Hour() == 0 && due.Minute() == 0 {
+		return due.Format("2006-01-02")
+	}
+	return due.Format(timeLayout)
+}
+
+// parseDue reads a YYYY-MM-DD date, midnight in local time, or an RFC 3339
+// timestamp. An empty value clears the due date.
+func parseDue(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if due, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &due, nil
+	}
+	due, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return &due, nil
+}
+
+// splitTags splits a comma separated list of tags.
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// noteFields are the flags that set the fields of a note.
+type noteFields struct {
+	head, note, priority, status, tags, due string
+}
+
+func (f *noteFields) register(fs *flag.FlagSet, withHead bool) {
+	if withHead {
+		fs.StringVar(&f.head, "head", "", "title")
+	}
+	fs.StringVar(&f.note, "note", "", "content")
+	fs.StringVar(&f.priority, "priority", "", "priority name")
+	fs.StringVar(&f.status, "status", "", "status key")
+	fs.StringVar(&f.tags, "tag", "", "comma separated tags")
+	fs.StringVar(&f.due, "due", "", "due date, YYYY-MM-DD or RFC 3339")
+}
+
+// apply sets the fields of a note whose flags were given.
+func (f *noteFields) apply(fs *flag.FlagSet, note *models.Note) error {
+	var err error
+	fs.Visit(func(set *flag.Flag) {
+		switch set.Name {
+		case "head":
+			note.Head = f.head
+		case "note":
+			note.Note = f.note
+		case "priority":
+			note.Priority = f.priority
+		case "status":
+			note.Status = f.status
+		case "tag":
+			note.Tags = splitTags(f.tags)
+		case "due":
+			if due, dueErr := parseDue(f.due); dueErr != nil {
+				err = dueErr
+			} else {
+				note.Metadata.Due = due
+			}
+		}
+	})
+	return err
+}
+
+// ============================================================================
+// Note Commands
+// ============================================================================
+
+// listNotes lists the notes of a workspace, or of one of its note blocks,
+// fetching every page unless -limit is given.
+func listNotes(app *app, name string, args []string) error {
+	fs := app.flags(name)
+	block := fs.Int64("block", 0, "only notes of this note block")
+	priority := fs.String("priority", "", "comma separated priorities")
+	status := fs.String("status", "", "comma separated statuses")
+	tag := fs.String("tag", "", "comma separated tags")
+	completed := fs.String("completed", "", "true or false")
+	text := fs.String("q", "", "text in the head or note")
+	sortBy := fs.String("sort", "", "comma separated fields, - for descending")
+	limit := fs.Int("limit", 0, "number of notes, all by default")
+
+	positional, err := parse(fs, args, 0, 1, "[-block ID | WORKSPACE]")
+	if err != nil {
+		return err
+	}
+
+	var path string
+	switch {
+	case *block != 0:
+		path = "/noteblocks/" + strconv.FormatInt(*block, 10) + "/notes"
+	case len(positional) == 1:
+		path = "/workspaces/" + escape(positional[0]) + "/notes"
+	default:
+		return fmt.Errorf("usage: %s [-block ID | WORKSPACE]", name)
+	}
+
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"priority": *priority, "status": *status, "tag": *tag, "completed": *completed, "q": *text, "sort": *sortBy,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	notes := []models.ListedNote{}
+	for {
+		pageSize := 200
+		if *limit > 0 && *limit-len(notes) < pageSize {
+			pageSize = *limit - len(notes)
+		}
+		query.Set("limit", strconv.Itoa(pageSize))
+
+		var page models.NotePage
+		if err := api.call(http.MethodGet, path, query, nil, &page); err != nil {
+			return err
+		}
+		notes = append(notes, page.Notes...)
+
+		if page.NextCursor == "" || (*limit > 0 && len(notes) >= *limit) {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	return app.print(notes, func(w *tabwriter.Writer) {
+		row(w, "ID", "DONE", "PRIORITY", "STATUS", "DUE", "HEAD", "TAGS", "BLOCK")
+		for _, note := range notes {
+			row(w, append(noteRow(note.Note), note.NoteBlockHead)...)
+		}
+	})
+}
+
+func createNote(app *app, name string, args []string) error {
+	fs := app.flags(name)
+	var fields noteFields
+	fields.register(fs, false)
+
+	positional, err := parse(fs, args, 2, 2, "BLOCK HEAD")
+	if err != nil {
+		return err
+	}
+	block, err := parseID(positional[0], "note block")
+	if err != nil {
+		return err
+	}
+
+	note := models.Note{Head: positional[1]}
+	if err := fields.apply(fs, &note); err != nil {
+		return err
+	}
+
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+	if err := api.call(http.MethodPost, "/noteblocks/"+strconv.FormatInt(block, 10)+"/notes", nil, note, &note); err != nil {
+		return err
+	}
+
+	return app.print(note, func(w *tabwriter.Writer) {
+		message(w, "Created note %v", note.ID)
+	})
+}
+
+func showNote(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var note models.Note
+	if err := api.call(http.MethodGet, "/notes/"+strconv.FormatInt(id, 10), nil, nil, &note); err != nil {
+		return err
+	}
+
+	return app.print(note, func(w *tabwriter.Writer) {
+		cells := noteRow(note)
+		row(w, "ID:", note.ID)
+		row(w, "Head:", note.Head)
+		row(w, "Completed:", cells[1])
+		row(w, "Priority:", note.Priority)
+		row(w, "Status:", note.Status)
+		row(w, "Tags:", cells[6])
+		row(w, "Due:", cells[4])
+		row(w, "Created:", note.Metadata.Created.Local().Format(timeLayout))
+		row(w, "Updated:", note.Metadata.Updated.Local().Format(timeLayout))
+		if note.Note != "" {
+			w.Flush()
+			fmt.Fprintf(app.out, "\n%s\n", note.Note)
+		}
+	})
+}
+
+// updateNote changes the fields given as flags and keeps the others.
+func updateNote(app *app, name string, args []string) error {
+	fs := app.flags(name)
+	var fields noteFields
+	fields.register(fs, true)
+
+	positional, err := parse(fs, args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	path := "/notes/" + strconv.FormatInt(id, 10)
+	var note models.Note
+	if err := api.call(http.MethodGet, path, nil, nil, &note); err != nil {
+		return err
+	}
+	if err := fields.apply(fs, &note); err != nil {
+		return err
+	}
+	if err := api.call(http.MethodPut, path, nil, note, &note); err != nil {
+		return err
+	}
+
+	return app.print(note, func(w *tabwriter.Writer) {
+		message(w, "Updated note %v", note.ID)
+	})
+}
+
+func toggleNote(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var note models.Note
+	if err := api.call(http.MethodPatch, "/notes/"+strconv.FormatInt(id, 10)+"/toggle", nil, nil, &note); err != nil {
+		return err
+	}
+
+	return app.print(note, func(w *tabwriter.Writer) {
+		if note.Metadata.Completed != nil && *note.Metadata.Completed {
+			message(w, "Completed note %v", note.ID)
+		} else {
+			message(w, "Reopened note %v", note.ID)
+		}
+	})
+}
+
+func deleteNote(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	if err := api.call(http.MethodDelete, "/notes/"+strconv.FormatInt(id, 10), nil, nil, nil); err != nil {
+		return err
+	}
+
+	return app.print(map[string]int64{"deleted": id}, func(w *tabwriter.Writer) {
+		message(w, "Deleted note %v", id)
+	})
+}
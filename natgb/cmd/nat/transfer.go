@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// workspaceExports are the export paths of a workspace by format.
+var workspaceExports = map[string]string{
+	"json": "/workspaces/%s/full",
+	"md":   "/workspaces/%s/export.md",
+	"csv":  "/export.csv?workspaceId=%s",
+	"txt":  "/workspaces/%s/export.txt",
+	"ics":  "/workspaces/%s/calendar.ics",
+}
+
+// userExports are the export paths of all workspaces by format.
+var userExports = map[string]string{
+	"json": "/export",
+	"csv":  "/export.csv",
+	"zip":  "/export.zip",
+}
+
+// fileFormat returns the format of a file from its extension, "markdown"
+// and "ical" spelled out too.
+func fileFormat(path string) string {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch format {
+	case "markdown":
+		return "md"
+	case "ical":
+		return "ics"
+	}
+	return format
+}
+
+// exportFile writes an export to -o, or to standard output.
+func exportFile(app *app, name string, args []string) error {
+	fs := app.flags(name)
+	format := fs.String("format", "", "file format, by default from -o or json")
+	output := fs.String("o", "", "file to write")
+
+	positional, err := parse(fs, args, 0, 1, "[WORKSPACE]")
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = fileFormat(*output)
+	}
+	if *format == "" {
+		*format = "json"
+	}
+
+	var path string
+	var ok bool
+	if len(positional) == 1 {
+		if path, ok = workspaceExports[*format]; ok {
+			path = fmt.Sprintf(path, url.PathEscape(positional[0]))
+		}
+	} else {
+		path, ok = userExports[*format]
+	}
+	if !ok {
+		return fmt.Errorf("cannot export %s files, see nat help", *format)
+	}
+
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	// Paths may carry their own query
+	path, rawQuery, _ := strings.Cut(path, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	data, err := api.do(http.MethodGet, path, query, nil, "")
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err := app.out.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+
+	exported := map[string]interface{}{"file": *output, "format": *format, "bytes": len(data)}
+	return app.print(exported, func(w *tabwriter.Writer) {
+		message(w, "Exported %d bytes to %s", len(data), *output)
+	})
+}
+
+// importFile sends a file to the import endpoint for its format. Files go
+// into an existing workspace, or create workspaces when none is given.
+func importFile(app *app, name string, args []string) error {
+	fs := app.flags(name)
+	format := fs.String("format", "", "file format, by default from the file extension")
+
+	positional, err := parse(fs, args, 1, 2, "[WORKSPACE] FILE")
+	if err != nil {
+		return err
+	}
+
+	file := positional[len(positional)-1]
+	if *format == "" {
+		*format = fileFormat(file)
+	}
+
+	var path string
+	if len(positional) == 2 {
+		switch *format {
+		case "md", "csv", "txt":
+			path = "/workspaces/" + escape(positional[0]) + "/import." + *format
+		default:
+			return fmt.Errorf("cannot import %s files into a workspace, see nat help", *format)
+		}
+	} else {
+		switch *format {
+		case "json":
+			path = "/import"
+		case "zip":
+			path = "/import.zip"
+		case "trello":
+			path = "/import/trello"
+		default:
+			return fmt.Errorf("cannot import %s files without a workspace, see nat help", *format)
+		}
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	data, err := api.do(http.MethodPost, path, nil, bytes.NewReader(content), importContentType(*format))
+	if err != nil {
+		var apiErr *apiError
+		if *format == "csv" && errors.As(err, &apiErr) && apiErr.status == http.StatusUnprocessableEntity {
+			return csvImportError(apiErr)
+		}
+		return err
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return app.print(result, func(w *tabwriter.Writer) {
+		message(w, "Imported %s", file)
+		printImport(w, *format, data)
+	})
+}
+
+func importContentType(format string) string {
+	switch format {
+	case "json", "trello":
+		return "application/json"
+	case "zip":
+		return "application/zip"
+	case "md":
+		return "text/markdown"
+	case "csv":
+		return "text/csv"
+	}
+	return "text/plain"
+}
+
+// printImport summarizes what an import created.
+func printImport(w io.Writer, format string, data []byte) {
+	var noteBlocks []models.NoteBlock
+	switch format {
+	case "md", "txt":
+		json.Unmarshal(data, &noteBlocks)
+	case "csv":
+		var report models.CSVImport
+		json.Unmarshal(data, &report)
+		noteBlocks = report.NoteBlocks
+	case "trello":
+		var workspace models.Workspace
+		json.Unmarshal(data, &workspace)
+		row(w, "Workspace", workspace.ID, workspace.Name)
+		noteBlocks = workspace.Data.NoteBlocks
+	default:
+		var result struct {
+			Workspaces int `json:"imported_workspaces"`
+		}
+		json.Unmarshal(data, &result)
+		row(w, "Workspaces", result.Workspaces)
+	}
+
+	for _, noteBlock := range noteBlocks {
+		row(w, fmt.Sprintf("[%d]", noteBlock.ID), noteBlock.Head, len(noteBlock.Notes), "notes")
+	}
+}
+
+// csvImportError lists the row errors of a rejected CSV import.
+func csvImportError(apiErr *apiError) error {
+	var report models.CSVImport
+	if err := json.Unmarshal([]byte(apiErr.message), &report); err != nil || len(report.Errors) == 0 {
+		return apiErr
+	}
+
+	lines := []string{"nothing imported:"}
+	for _, rowErr := range report.Errors {
+		where := fmt.Sprintf("row %d", rowErr.Row)
+		if rowErr.Column != "" {
+			where += ", " + rowErr.Column
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", where, rowErr.Message))
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
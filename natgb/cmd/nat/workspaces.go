@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// timeLayout shows times in local time to the minute.
+const timeLayout = "2006-01-02 15:04"
+
+// ============================================================================
+// Workspace Commands
+// ============================================================================
+
+func listWorkspaces(app *app, name string, args []string) error {
+	if _, err := parse(app.flags(name), args, 0, 0, ""); err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var workspaces []models.Workspace
+	if err := api.call(http.MethodGet, "/workspaces", nil, nil, &workspaces); err != nil {
+		return err
+	}
+
+	return app.print(workspaces, func(w *tabwriter.Writer) {
+		row(w, "ID", "NAME", "MODIFIED")
+		for _, workspace := range workspaces {
+			row(w, workspace.ID, workspace.Name, workspace.LastModified.Local().Format(timeLayout))
+		}
+	})
+}
+
+func createWorkspace(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "NAME")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	workspace := models.Workspace{Name: positional[0]}
+	if err := api.call(http.MethodPost, "/workspaces", nil, workspace, &workspace); err != nil {
+		return err
+	}
+
+	return app.print(workspace, func(w *tabwriter.Writer) {
+		message(w, "Created workspace %v", workspace.ID)
+	})
+}
+
+// showWorkspace prints a workspace as its note blocks, each followed by its
+// notes.
+func showWorkspace(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var workspace models.Workspace
+	if err := api.call(http.MethodGet, "/workspaces/"+escape(positional[0])+"/full", nil, nil, &workspace); err != nil {
+		return err
+	}
+
+	return app.print(workspace, func(w *tabwriter.Writer) {
+		row(w, workspace.Name, "("+workspace.ID+")")
+		for _, noteBlock := range workspace.Data.NoteBlocks {
+			row(w)
+			row(w, fmt.Sprintf("[%d]", noteBlock.ID), noteBlock.Head)
+			for _, note := range noteBlock.Notes {
+				row(w, noteRow(note)...)
+			}
+		}
+	})
+}
+
+// renameWorkspace keeps everything but the name of a workspace.
+func renameWorkspace(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 2, 2, "ID NAME")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	path := "/workspaces/" + escape(positional[0])
+	var workspace models.Workspace
+	if err := api.call(http.MethodGet, path, nil, nil, &workspace); err != nil {
+		return err
+	}
+	workspace.Name = positional[1]
+	if err := api.call(http.MethodPut, path, nil, workspace, &workspace); err != nil {
+		return err
+	}
+
+	return app.print(workspace, func(w *tabwriter.Writer) {
+		message(w, "Renamed workspace %v", workspace.ID)
+	})
+}
+
+func deleteWorkspace(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	if err := api.call(http.MethodDelete, "/workspaces/"+escape(positional[0]), nil, nil, nil); err != nil {
+		return err
+	}
+
+	return app.print(map[string]string{"deleted": positional[0]}, func(w *tabwriter.Writer) {
+		message(w, "Deleted workspace %v", positional[0])
+	})
+}
+
+// ============================================================================
+// Note Block Commands
+// ============================================================================
+
+func listNoteBlocks(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "WORKSPACE")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var noteBlocks []models.NoteBlock
+	if err := api.call(http.MethodGet, "/workspaces/"+escape(positional[0])+"/noteblocks", nil, nil, &noteBlocks); err != nil {
+		return err
+	}
+
+	return app.print(noteBlocks, func(w *tabwriter.Writer) {
+		row(w, "ID", "HEAD", "UPDATED")
+		for _, noteBlock := range noteBlocks {
+			row(w, noteBlock.ID, noteBlock.Head, noteBlock.Metadata.Updated.Local().Format(timeLayout))
+		}
+	})
+}
+
+func createNoteBlock(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 2, 2, "WORKSPACE HEAD")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	noteBlock := models.NoteBlock{Head: positional[1]}
+	if err := api.call(http.MethodPost, "/workspaces/"+escape(positional[0])+"/noteblocks", nil, noteBlock, &noteBlock); err != nil {
+		return err
+	}
+
+	return app.print(noteBlock, func(w *tabwriter.Writer) {
+		message(w, "Created note block %v", noteBlock.ID)
+	})
+}
+
+func renameNoteBlock(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 2, 2, "ID HEAD")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note block")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	path := "/noteblocks/" + strconv.FormatInt(id, 10)
+	var noteBlock models.NoteBlock
+	if err := api.call(http.MethodGet, path, nil, nil, &noteBlock); err != nil {
+		return err
+	}
+	noteBlock.Head = positional[1]
+	noteBlock.Notes = nil
+	if err := api.call(http.MethodPut, path, nil, noteBlock, &noteBlock); err != nil {
+		return err
+	}
+
+	return app.print(noteBlock, func(w *tabwriter.Writer) {
+		message(w, "Renamed note block %v", noteBlock.ID)
+	})
+}
+
+func deleteNoteBlock(app *app, name string, args []string) error {
+	positional, err := parse(app.flags(name), args, 1, 1, "ID")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(positional[0], "note block")
+	if err != nil {
+		return err
+	}
+	api, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	if err := api.call(http.MethodDelete, "/noteblocks/"+strconv.FormatInt(id, 10), nil, nil, nil); err != nil {
+		return err
+	}
+
+	return app.print(map[string]int64{"deleted": id}, func(w *tabwriter.Writer) {
+		message(w, "Deleted note block %v", id)
+	})
+}
+
+func parseID(value, kind string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", kind, value)
+	}
+	return id, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tanjeetsarkar/nat/models"
 )
 
 type Database struct {
@@ -62,9 +63,240 @@ func (db *Database) createTables() error {
 			metadata_created DATETIME NOT NULL,
 			metadata_updated DATETIME NOT NULL,
 			metadata_completed BOOLEAN DEFAULT FALSE,
+			metadata_completed_at DATETIME,
+			status TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '[]',
+			metadata_due DATETIME,
 			note_block_id INTEGER NOT NULL,
 			FOREIGN KEY (note_block_id) REFERENCES note_blocks(id) ON DELETE CASCADE
 		)`,
+
+		// Users table - owners of personal access tokens
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created DATETIME NOT NULL
+		)`,
+
+		// API tokens table - only the SHA-256 hash of each token is stored
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			prefix TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			read_only BOOLEAN DEFAULT FALSE,
+			workspace_id TEXT,
+			created DATETIME NOT NULL,
+			last_used DATETIME,
+			revoked DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Workspace members table - grants users a role on a workspace
+		`CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'commenter', 'viewer')),
+			created DATETIME NOT NULL,
+			PRIMARY KEY (workspace_id, user_id),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Share links table - anonymous read-only access by unguessable token
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id INTEGER PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			note_block_id INTEGER,
+			prefix TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_by TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			expires DATETIME,
+			revoked DATETIME,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+			FOREIGN KEY (note_block_id) REFERENCES note_blocks(id) ON DELETE CASCADE
+		)`,
+
+		// Audit log table - append-only, deliberately without foreign keys so
+		// entries outlive the entities they describe
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			entity_type TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			timestamp DATETIME NOT NULL,
+			before TEXT,
+			after TEXT
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'audit log is append-only');
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'audit log is append-only');
+		END`,
+
+		// Webhooks table - event subscriptions per workspace
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			events TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			active BOOLEAN DEFAULT TRUE,
+			created DATETIME NOT NULL,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Webhook deliveries table - outbox and delivery history
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY,
+			webhook_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_code INTEGER,
+			error TEXT NOT NULL DEFAULT '',
+			next_attempt DATETIME,
+			created DATETIME NOT NULL,
+			delivered DATETIME,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		)`,
+
+		// Operations table - undo/redo history per workspace
+		`CREATE TABLE IF NOT EXISTS operations (
+			id INTEGER PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			entity_type TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			parent_id TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL DEFAULT '',
+			created DATETIME NOT NULL,
+			undone BOOLEAN DEFAULT FALSE,
+			before TEXT,
+			after TEXT,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Templates table - reusable workspace structures per user
+		`CREATE TABLE IF NOT EXISTS templates (
+			id INTEGER PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			include_notes BOOLEAN DEFAULT FALSE,
+			note_blocks TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Note events table - lifecycle history of notes, kept after deletion.
+		// Rows are written by the triggers in createTriggers.
+		`CREATE TABLE IF NOT EXISTS note_events (
+			id INTEGER PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			note_block_id INTEGER NOT NULL,
+			note_id INTEGER NOT NULL,
+			event TEXT NOT NULL CHECK (event IN ('created', 'completed', 'reopened', 'deleted')),
+			timestamp DATETIME NOT NULL
+		)`,
+
+		// Workspace statuses table - the workflow of notes per workspace
+		`CREATE TABLE IF NOT EXISTS workspace_statuses (
+			workspace_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			name TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			terminal BOOLEAN DEFAULT FALSE,
+			PRIMARY KEY (workspace_id, key),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Workspace priorities table - the priorities notes can have per workspace
+		`CREATE TABLE IF NOT EXISTS workspace_priorities (
+			workspace_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			rank INTEGER NOT NULL,
+			color TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (workspace_id, name),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Note dependencies table - a note is blocked by the note it depends on
+		`CREATE TABLE IF NOT EXISTS note_dependencies (
+			note_id INTEGER NOT NULL,
+			depends_on_id INTEGER NOT NULL,
+			created DATETIME NOT NULL,
+			PRIMARY KEY (note_id, depends_on_id),
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (depends_on_id) REFERENCES notes(id) ON DELETE CASCADE
+		)`,
+
+		// Saved views table - named note filters of a user or a workspace
+		`CREATE TABLE IF NOT EXISTS saved_views (
+			id INTEGER PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			workspace_id TEXT,
+			name TEXT NOT NULL,
+			filter TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			updated DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+
+		// Comments table - threaded discussion on notes, soft deleted
+		`CREATE TABLE IF NOT EXISTS comments (
+			id INTEGER PRIMARY KEY,
+			note_id INTEGER NOT NULL,
+			parent_id INTEGER,
+			author_id TEXT,
+			author_name TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created DATETIME NOT NULL,
+			edited DATETIME,
+			deleted DATETIME,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE,
+			FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+		)`,
+
+		// Attachments table - files on notes, their content is in the blob store
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY,
+			note_id INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			checksum TEXT NOT NULL,
+			blob_key TEXT NOT NULL UNIQUE,
+			uploader_id TEXT,
+			created DATETIME NOT NULL,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE SET NULL
+		)`,
+
+		// Calendar objects table - CalDAV resource names and UIDs of notes
+		`CREATE TABLE IF NOT EXISTS calendar_objects (
+			note_id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			uid TEXT NOT NULL,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		)`,
+
+		// Orphaned blobs table - content of deleted attachments awaiting removal
+		`CREATE TABLE IF NOT EXISTS orphaned_blobs (
+			blob_key TEXT PRIMARY KEY
+		)`,
 	}
 
 	for _, query := range queries {
@@ -73,15 +305,235 @@ func (db *Database) createTables() error {
 		}
 	}
 
+	if err := db.addColumns(); err != nil {
+		return err
+	}
+
+	if err := db.seedWorkspaceDefaults(); err != nil {
+		return err
+	}
+
+	if err := db.createTriggers(); err != nil {
+		return err
+	}
+
 	return db.createIndexes()
 }
 
+// createTriggers creates triggers that depend on columns added by addColumns.
+func (db *Database) createTriggers() error {
+	statements := []string{
+		// Note events capture every writer, including imports, copies and
+		// cascading deletes. Notes restored by undo keep their ID and
+		// metadata, so their events are dated now to follow the deletion.
+		`DROP TRIGGER IF EXISTS note_events_created`,
+		`CREATE TRIGGER note_events_created AFTER INSERT ON notes
+		BEGIN
+			INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+			SELECT workspace_id, NEW.note_block_id, NEW.id, 'created',
+				CASE WHEN EXISTS (SELECT 1 FROM note_events WHERE note_id = NEW.id AND event = 'deleted')
+				THEN strftime('%Y-%m-%d %H:%M:%f', 'now') ELSE NEW.metadata_created END
+			FROM note_blocks WHERE id = NEW.note_block_id;
+			INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+			SELECT workspace_id, NEW.note_block_id, NEW.id, 'completed',
+				CASE WHEN EXISTS (SELECT 1 FROM note_events WHERE note_id = NEW.id AND event = 'deleted')
+				THEN strftime('%Y-%m-%d %H:%M:%f', 'now') ELSE COALESCE(NEW.metadata_completed_at, NEW.metadata_updated) END
+			FROM note_blocks WHERE id = NEW.note_block_id AND NEW.metadata_completed;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS note_events_completion AFTER UPDATE OF metadata_completed ON notes
+		WHEN NEW.metadata_completed != OLD.metadata_completed
+		BEGIN
+			INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+			SELECT workspace_id, NEW.note_block_id, NEW.id,
+				CASE WHEN NEW.metadata_completed THEN 'completed' ELSE 'reopened' END,
+				CASE WHEN NEW.metadata_completed THEN COALESCE(NEW.metadata_completed_at, NEW.metadata_updated) ELSE NEW.metadata_updated END
+			FROM note_blocks WHERE id = NEW.note_block_id;
+		END`,
+		// Notes removed together with their block are recorded by the block
+		// trigger, since the block is gone by the time they are deleted
+		`CREATE TRIGGER IF NOT EXISTS note_events_deleted AFTER DELETE ON notes
+		WHEN EXISTS (SELECT 1 FROM note_blocks WHERE id = OLD.note_block_id)
+		BEGIN
+			INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+			SELECT workspace_id, OLD.note_block_id, OLD.id, 'deleted', strftime('%Y-%m-%d %H:%M:%f', 'now')
+			FROM note_blocks WHERE id = OLD.note_block_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS note_events_block_deleted BEFORE DELETE ON note_blocks
+		WHEN EXISTS (SELECT 1 FROM workspaces WHERE id = OLD.workspace_id)
+		BEGIN
+			INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+			SELECT OLD.workspace_id, OLD.id, id, 'deleted', strftime('%Y-%m-%d %H:%M:%f', 'now')
+			FROM notes WHERE note_block_id = OLD.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS note_events_workspace_deleted AFTER DELETE ON workspaces
+		BEGIN
+			DELETE FROM note_events WHERE workspace_id = OLD.id;
+		END`,
+
+		// Attachments also go with their note, block or workspace, so their
+		// blobs are queued for removal here
+		`CREATE TRIGGER IF NOT EXISTS attachments_deleted AFTER DELETE ON attachments
+		BEGIN
+			INSERT OR IGNORE INTO orphaned_blobs (blob_key) VALUES (OLD.blob_key);
+		END`,
+
+		// Seed the history of notes that predate note events
+		`INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+		SELECT nb.workspace_id, n.note_block_id, n.id, 'created', n.metadata_created
+		FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id
+		WHERE NOT EXISTS (SELECT 1 FROM note_events e WHERE e.note_id = n.id)`,
+		`INSERT INTO note_events (workspace_id, note_block_id, note_id, event, timestamp)
+		SELECT nb.workspace_id, n.note_block_id, n.id, 'completed', COALESCE(n.metadata_completed_at, n.metadata_updated)
+		FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id
+		WHERE n.metadata_completed
+		AND NOT EXISTS (SELECT 1 FROM note_events e WHERE e.note_id = n.id AND e.event != 'created')`,
+	}
+
+	for _, statement := range statements {
+		if _, err := db.Conn.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create note event triggers: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addColumns adds columns introduced after a table was first created to
+// existing databases. The backfill query, if any, runs once when the column
+// is added.
+func (db *Database) addColumns() error {
+	columns := []struct {
+		table, column, definition, backfill string
+	}{
+		// Completion timestamps of notes completed before they were recorded
+		// are approximated by their last update
+		{"notes", "metadata_completed_at", "DATETIME",
+			`UPDATE notes SET metadata_completed_at = metadata_updated WHERE metadata_completed = true`},
+		// Existing notes map onto the default statuses
+		{"notes", "status", "TEXT NOT NULL DEFAULT ''",
+			`UPDATE notes SET status = CASE WHEN metadata_completed THEN 'done' ELSE 'todo' END`},
+		{"notes", "tags", "TEXT NOT NULL DEFAULT '[]'", ""},
+		{"notes", "metadata_due", "DATETIME", ""},
+		// Workspace deletions record who may still read the trail
+		{"audit_log", "owners", "TEXT", ""},
+	}
+
+	for _, column := range columns {
+		exists, err := db.hasColumn(column.table, column.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, column.table, column.column, column.definition)
+		if _, err := db.Conn.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.column, err)
+		}
+
+		if column.backfill != "" {
+			if _, err := db.Conn.Exec(column.backfill); err != nil {
+				return fmt.Errorf("failed to backfill column %s.%s: %w", column.table, column.column, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedWorkspaceDefaults gives workspaces created before statuses and
+// priorities were configurable the default ones.
+func (db *Database) seedWorkspaceDefaults() error {
+	workspaceIDs, err := db.workspacesWithout("workspace_statuses")
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO workspace_statuses (workspace_id, key, name, position, terminal) VALUES (?, ?, ?, ?, ?)`
+	for _, id := range workspaceIDs {
+		for _, status := range models.DefaultNoteStatuses {
+			if _, err := db.Conn.Exec(query, id, status.Key, status.Name, status.Position, status.Terminal); err != nil {
+				return fmt.Errorf("failed to seed statuses: %w", err)
+			}
+		}
+	}
+
+	workspaceIDs, err = db.workspacesWithout("workspace_priorities")
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO workspace_priorities (workspace_id, name, rank, color) VALUES (?, ?, ?, ?)`
+	for _, id := range workspaceIDs {
+		for _, priority := range models.DefaultNotePriorities {
+			if _, err := db.Conn.Exec(query, id, priority.Name, priority.Rank, priority.Color); err != nil {
+				return fmt.Errorf("failed to seed priorities: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// workspacesWithout returns the workspaces without rows in a table keyed by
+// workspace_id.
+func (db *Database) workspacesWithout(table string) ([]string, error) {
+	query := fmt.Sprintf(`SELECT id FROM workspaces w
+		WHERE NOT EXISTS (SELECT 1 FROM %s t WHERE t.workspace_id = w.id)`, table)
+
+	rows, err := db.Conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workspaces without %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var workspaceIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace id: %w", err)
+		}
+		workspaceIDs = append(workspaceIDs, id)
+	}
+
+	return workspaceIDs, nil
+}
+
+func (db *Database) hasColumn(table, column string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`
+
+	var exists bool
+	if err := db.Conn.QueryRow(query, table, column).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+
+	return exists, nil
+}
+
 func (db *Database) createIndexes() error {
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_note_blocks_workspace ON note_blocks(workspace_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_notes_note_block ON notes(note_block_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_notes_priority ON notes(priority)`,
 		`CREATE INDEX IF NOT EXISTS idx_notes_completed ON notes(metadata_completed)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_workspace_members_user ON workspace_members(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_workspace ON share_links(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_workspace ON audit_log(workspace_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhooks_workspace ON webhooks(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt)`,
+		`CREATE INDEX IF NOT EXISTS idx_operations_workspace ON operations(workspace_id, undone)`,
+		`CREATE INDEX IF NOT EXISTS idx_templates_user ON templates(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_note_events_workspace ON note_events(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_note_events_note ON note_events(note_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_status ON notes(note_block_id, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_saved_views_user ON saved_views(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_note_dependencies_depends_on ON note_dependencies(depends_on_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_note ON comments(note_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_note ON attachments(note_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_saved_views_workspace ON saved_views(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_calendar_objects_name ON calendar_objects(name)`,
 	}
 
 	for _, index := range indexes {
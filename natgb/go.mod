@@ -3,6 +3,6 @@ module github.com/tanjeetsarkar/nat
 go 1.24.1
 
 require (
-	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/mattn/go-sqlite3 v1.14.32 // indirect
+	github.com/gorilla/mux v1.8.1
+	github.com/mattn/go-sqlite3 v1.14.32
 )
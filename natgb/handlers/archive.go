@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// Export archives are zip files with a manifest.json listing the checksums of
+// the data document and of every attachment.
+const (
+	archiveFormat   = "nat-archive"
+	archiveVersion  = 1
+	archiveManifest = "manifest.json"
+	archiveData     = "data.json"
+
+	// maxArchiveSize is the largest archive accepted for import, and
+	// maxArchiveContentSize the largest total size of its files once
+	// uncompressed
+	maxArchiveSize        = 512 << 20
+	maxArchiveContentSize = 1 << 30
+)
+
+// attachmentPath is where the content of an attachment is kept in archives.
+func attachmentPath(attachment models.Attachment) string {
+	return fmt.Sprintf("attachments/%d/%s", attachment.ID, attachment.Filename)
+}
+
+// archiveWriter writes zip entries and records them for the manifest.
+type archiveWriter struct {
+	zip   *zip.Writer
+	files []models.ArchiveFile
+}
+
+func (a *archiveWriter) add(path string, modified time.Time, content io.Reader) error {
+	file, err := a.zip.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if err != nil {
+		return err
+	}
+
+	a.files = append(a.files, models.ArchiveFile{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	return nil
+}
+
+// openArchiveFile opens a file listed in a manifest, checking while it is
+// read that its size and checksum match.
+func openArchiveFile(archive *zip.Reader, listed models.ArchiveFile) (io.ReadCloser, error) {
+	file, err := archive.Open(listed.Path)
+	if err != nil {
+		return nil, fmt.Errorf("archive is missing %s", listed.Path)
+	}
+	return &verifiedReader{file: file, listed: listed, hash: sha256.New()}, nil
+}
+
+// verifiedReader fails at the end of a file whose content does not match its
+// manifest entry.
+type verifiedReader struct {
+	file   io.ReadCloser
+	listed models.ArchiveFile
+	hash   hash.Hash
+	size   int64
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.file.Read(p)
+	v.hash.Write(p[:n])
+	v.size += int64(n)
+	if v.size > v.listed.Size {
+		return n, fmt.Errorf("checksum mismatch for %s", v.listed.Path)
+	}
+	if err == io.EOF && (v.size != v.listed.Size || hex.EncodeToString(v.hash.Sum(nil)) != v.listed.SHA256) {
+		return n, fmt.Errorf("checksum mismatch for %s", v.listed.Path)
+	}
+	return n, err
+}
+
+func (v *verifiedReader) Close() error {
+	return v.file.Close()
+}
+
+// readArchive checks the manifest and every file of an archive and returns
+// the export data with the archived attachments by path.
+func readArchive(archive *zip.Reader) (*models.ExportData, map[string]models.ArchiveFile, error) {
+	file, err := archive.Open(archiveManifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("archive has no %s", archiveManifest)
+	}
+	defer file.Close()
+
+	var manifest models.ArchiveManifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s", archiveManifest)
+	}
+	if manifest.Format != archiveFormat {
+		return nil, nil, fmt.Errorf("not a %s", archiveFormat)
+	}
+	if manifest.Version < 1 || manifest.Version > archiveVersion {
+		return nil, nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+
+	// Reading is bounded by the sizes listed, so check those before
+	// inflating anything. Files besides the data are attachments.
+	var total int64
+	seen := make(map[string]bool, len(manifest.Files))
+	for _, listed := range manifest.Files {
+		if seen[listed.Path] {
+			return nil, nil, fmt.Errorf("manifest lists %s twice", listed.Path)
+		}
+		seen[listed.Path] = true
+
+		if listed.Size < 0 || (listed.Path != manifest.Data && listed.Size > maxAttachmentSize) {
+			return nil, nil, fmt.Errorf("file %s is too large", listed.Path)
+		}
+		total += listed.Size
+		if total > maxArchiveContentSize {
+			return nil, nil, fmt.Errorf("archive content is too large")
+		}
+	}
+
+	// Verify everything before decoding anything
+	files := make(map[string]models.ArchiveFile, len(manifest.Files))
+	for _, listed := range manifest.Files {
+		content, err := openArchiveFile(archive, listed)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = io.Copy(io.Discard, content)
+		content.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		files[listed.Path] = listed
+	}
+
+	listed, ok := files[manifest.Data]
+	if !ok {
+		return nil, nil, fmt.Errorf("manifest does not list %s", manifest.Data)
+	}
+	content, err := openArchiveFile(archive, listed)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer content.Close()
+
+	var data models.ExportData
+	if err := json.NewDecoder(content).Decode(&data); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s", manifest.Data)
+	}
+
+	return &data, files, nil
+}
+
+// ============================================================================
+// Archive Handlers
+// ============================================================================
+
+// HandleExportArchive exports the caller's workspaces like HandleExportData,
+// as data.json in a zip archive that also holds the content of every
+// attachment under attachments/, and a manifest.json with their checksums.
+func (s *Server) HandleExportArchive(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	exportData, err := s.Repos.Workspace.ExportForUser(ctx, token.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(exportData)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=todo-export-%s.zip",
+		time.Now().Format("2006-01-02-15-04-05")))
+
+	// The archive is streamed, so failures past this point can only cut it
+	// short, which imports detect by the missing manifest
+	archive := &archiveWriter{zip: zip.NewWriter(w)}
+	if err := s.writeArchive(ctx, archive, exportData, data); err != nil {
+		log.Printf("export: %v", err)
+		return
+	}
+	if err := archive.zip.Close(); err != nil {
+		log.Printf("export: %v", err)
+	}
+}
+
+// writeArchive adds the data document and the attachments, then the
+// manifest listing them.
+func (s *Server) writeArchive(ctx context.Context, archive *archiveWriter, exportData *models.ExportData, data []byte) error {
+	if err := archive.add(archiveData, exportData.ExportDate, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if s.Blobs != nil {
+		for _, workspace := range exportData.Workspaces {
+			for _, noteBlock := range workspace.Data.NoteBlocks {
+				for _, note := range noteBlock.Notes {
+					for _, attachment := range note.Attachments {
+						content, err := s.Blobs.Get(ctx, attachment.BlobKey)
+						if err != nil {
+							return err
+						}
+						err = archive.add(attachmentPath(attachment), attachment.Created, content)
+						content.Close()
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	manifest, err := json.MarshalIndent(models.ArchiveManifest{
+		Format:     archiveFormat,
+		Version:    archiveVersion,
+		ExportDate: exportData.ExportDate,
+		Data:       archiveData,
+		Files:      archive.files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := archive.zip.CreateHeader(&zip.FileHeader{Name: archiveManifest, Method: zip.Deflate, Modified: exportData.ExportDate})
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(manifest)
+	return err
+}
+
+// HandleImportArchive imports an archive made by HandleExportArchive, sent as
+// the request body. The whole archive is checked against its manifest before
+// anything is imported.
+func (s *Server) HandleImportArchive(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	// Zip archives are read from the end, so spool the body to disk first
+	spool, err := os.CreateTemp("", "nat-import-*.zip")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, http.MaxBytesReader(w, r.Body, maxArchiveSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Archive is too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Failed to read archive", http.StatusBadRequest)
+		}
+		return
+	}
+
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		http.Error(w, "Invalid zip archive", http.StatusBadRequest)
+		return
+	}
+
+	importData, files, err := readArchive(archive)
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Store the content of the attachments, which the import then refers to
+	ctx := context.Background()
+	var stored []string
+	removeStored := func() {
+		for _, key := range stored {
+			s.Blobs.Delete(ctx, key)
+		}
+	}
+
+	for i := range importData.Workspaces {
+		for j := range importData.Workspaces[i].Data.NoteBlocks {
+			notes := importData.Workspaces[i].Data.NoteBlocks[j].Notes
+			for k := range notes {
+				attachments := notes[k].Attachments
+				for l := range attachments {
+					attachment := &attachments[l]
+					listed, ok := files[attachmentPath(*attachment)]
+					if !ok || listed.SHA256 != attachment.Checksum || s.Blobs == nil {
+						continue
+					}
+
+					// Archived attachments meet the same rules as uploads
+					attachment.Filename = attachmentFilename(attachment.Filename)
+					if attachment.Filename == "" {
+						removeStored()
+						http.Error(w, fmt.Sprintf("Attachment %s has no filename", listed.Path), http.StatusUnprocessableEntity)
+						return
+					}
+					contentType, err := archivedContentType(archive, listed, attachment.ContentType)
+					if err != nil {
+						removeStored()
+						http.Error(w, capitalize(err.Error()), http.StatusUnprocessableEntity)
+						return
+					}
+					if !attachmentContentTypes[contentType] {
+						removeStored()
+						http.Error(w, fmt.Sprintf("Unsupported content type %s for %s", contentType, listed.Path), http.StatusUnprocessableEntity)
+						return
+					}
+
+					key, err := s.storeArchivedAttachment(ctx, archive, listed)
+					if err != nil {
+						removeStored()
+						http.Error(w, fmt.Sprintf("Failed to store attachment: %v", err), http.StatusInternalServerError)
+						return
+					}
+					stored = append(stored, key)
+					attachment.BlobKey = key
+					attachment.Size = listed.Size
+					attachment.ContentType = contentType
+				}
+			}
+		}
+	}
+
+	if err := s.Repos.Workspace.ImportWorkspaces(ctx, importData.Workspaces, token.UserID); err != nil {
+		removeStored()
+		http.Error(w, fmt.Sprintf("Failed to import data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.finishImport(w, r, importData.Workspaces)
+}
+
+// archivedContentType returns the media type of an archived attachment like
+// attachmentContentType does for uploads, from the declared type and the
+// start of its content.
+func archivedContentType(archive *zip.Reader, listed models.ArchiveFile, declared string) (string, error) {
+	content, err := openArchiveFile(archive, listed)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return attachmentContentType(declared, head[:n]), nil
+}
+
+func (s *Server) storeArchivedAttachment(ctx context.Context, archive *zip.Reader, listed models.ArchiveFile) (string, error) {
+	key, err := newBlobKey()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := openArchiveFile(archive, listed)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	if _, err := s.Blobs.Put(ctx, key, content); err != nil {
+		s.Blobs.Delete(ctx, key)
+		return "", err
+	}
+	return key, nil
+}
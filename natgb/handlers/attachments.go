@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// maxAttachmentSize is the largest file accepted as an attachment.
+const maxAttachmentSize = 10 << 20
+
+// attachmentContentTypes are the media types attachments may have. Types
+// browsers would render as active content, like HTML and SVG, are left out.
+var attachmentContentTypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"text/markdown":    true,
+	"application/json": true,
+	"application/pdf":  true,
+	"application/zip":  true,
+	"application/gzip": true,
+}
+
+// attachmentContentType returns the media type of an upload: the declared
+// one, or the sniffed one when the client did not know.
+func attachmentContentType(declared string, head []byte) string {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	return mediaType
+}
+
+// attachmentFilename keeps the base name of an uploaded file.
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+func newBlobKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// purgeBlobs removes the content of deleted attachments from the blob store.
+// Blobs that cannot be removed are retried by the next purge.
+func (s *Server) purgeBlobs(ctx context.Context) {
+	if s.Blobs == nil {
+		return
+	}
+
+	keys, err := s.Repos.Attachment.GetOrphanedBlobs(ctx)
+	if err != nil {
+		log.Printf("attachments: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		if err := s.Blobs.Delete(ctx, key); err != nil {
+			log.Printf("attachments: %v", err)
+			continue
+		}
+		if err := s.Repos.Attachment.ForgetOrphanedBlob(ctx, key); err != nil {
+			log.Printf("attachments: %v", err)
+		}
+	}
+}
+
+// noteAttachment loads an attachment of the note in the route.
+func (s *Server) noteAttachment(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	vars := mux.Vars(r)
+	noteID, _ := strconv.ParseInt(vars["id"], 10, 64)
+
+	id, err := strconv.ParseInt(vars["attachmentId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	attachment, err := s.Repos.Attachment.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get attachment: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	if attachment.NoteID != noteID {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return attachment, true
+}
+
+// ============================================================================
+// Attachment Handlers
+// ============================================================================
+
+func (s *Server) HandleGetAttachments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	attachments, err := s.Repos.Attachment.GetByNoteID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get attachments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// HandleUploadAttachment attaches the "file" part of a multipart/form-data
+// body to a note. Files are limited to maxAttachmentSize and to the
+// attachmentContentTypes.
+func (s *Server) HandleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if s.Blobs == nil {
+		http.Error(w, "Attachments are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	var filename string
+	var file *bufio.Reader
+	var declared string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "File is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() == "file" {
+			filename = attachmentFilename(part.FileName())
+			file = bufio.NewReaderSize(part, 512)
+			declared = part.Header.Get("Content-Type")
+			break
+		}
+	}
+
+	if filename == "" {
+		http.Error(w, "Filename is required", http.StatusBadRequest)
+		return
+	}
+
+	head, _ := file.Peek(512)
+	contentType := attachmentContentType(declared, head)
+	if !attachmentContentTypes[contentType] {
+		http.Error(w, fmt.Sprintf("Unsupported content type %s", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store attachment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.Background()
+	hash := sha256.New()
+	size, err := s.Blobs.Put(ctx, key, io.TeeReader(io.LimitReader(file, maxAttachmentSize+1), hash))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Attachment is too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to store attachment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	if size > maxAttachmentSize {
+		s.Blobs.Delete(ctx, key)
+		http.Error(w, "Attachment is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	token := requestToken(r)
+	attachment := models.Attachment{
+		NoteID:      id,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		UploaderID:  &token.UserID,
+		BlobKey:     key,
+	}
+	if err := s.Repos.Attachment.Create(ctx, &attachment); err != nil {
+		s.Blobs.Delete(ctx, key)
+		http.Error(w, fmt.Sprintf("Failed to create attachment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityAttachment, EntityID: formatID(attachment.ID), Action: models.ActionCreate,
+	}, nil, attachment)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// HandleDownloadAttachment responds with the content of an attachment, always
+// as a download.
+func (s *Server) HandleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if s.Blobs == nil {
+		http.Error(w, "Attachments are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	attachment, ok := s.noteAttachment(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	content, err := s.Blobs.Get(ctx, attachment.BlobKey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read attachment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+	io.Copy(w, content)
+}
+
+func (s *Server) HandleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	attachment, ok := s.noteAttachment(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Repos.Attachment.Delete(ctx, attachment.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete attachment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.purgeBlobs(ctx)
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityAttachment, EntityID: formatID(attachment.ID), Action: models.ActionDelete,
+	}, attachment, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// recordMutation appends a mutation to the audit log, queues the webhook
+// events it triggers and records it in the undo history of the workspace.
+// The mutation itself has already been applied, so failures are logged
+// rather than returned.
+func (s *Server) recordMutation(r *http.Request, entry models.AuditEntry, before, after interface{}) {
+	entry = s.logMutation(r, entry, before, after)
+	s.recordOperation(entry, before, after)
+}
+
+// logMutation audits a mutation and dispatches its webhook events, without
+// touching the undo history. Undo and redo use it directly.
+func (s *Server) logMutation(r *http.Request, entry models.AuditEntry, before, after interface{}) models.AuditEntry {
+	if token := requestToken(r); token != nil {
+		entry.Actor = token.UserID
+	}
+
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		log.Printf("audit: failed to encode snapshot of %s %s: %v", entry.EntityType, entry.EntityID, err)
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		log.Printf("audit: failed to encode snapshot of %s %s: %v", entry.EntityType, entry.EntityID, err)
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Audit.Append(ctx, &entry); err != nil {
+		log.Printf("audit: failed to record %s of %s %s: %v", entry.Action, entry.EntityType, entry.EntityID, err)
+	}
+
+	s.dispatchEvents(entry, before, after)
+	return entry
+}
+
+func snapshot(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// noteBlockWithNotes loads a note block together with its notes, so that
+// snapshots of deleted blocks include everything the cascade removed.
+func (s *Server) noteBlockWithNotes(ctx context.Context, id int64) (*models.NoteBlock, error) {
+	noteBlock, err := s.Repos.NoteBlock.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.Repos.Note.GetByNoteBlockID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	noteBlock.Notes = notes
+
+	return noteBlock, nil
+}
+
+// ============================================================================
+// Audit Handlers
+// ============================================================================
+
+// HandleGetAuditLog lists audit entries of one workspace, newest first.
+// Owners can read the trail of a workspace; once a workspace is deleted its
+// trail stays readable by the users who owned it then.
+func (s *Server) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := models.AuditFilter{
+		WorkspaceID: query.Get("workspaceId"),
+		EntityType:  query.Get("entityType"),
+		EntityID:    query.Get("entityId"),
+		Action:      query.Get("action"),
+		Actor:       query.Get("actor"),
+	}
+
+	if filter.WorkspaceID == "" {
+		http.Error(w, "workspaceId is required", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		http.Error(w, "Invalid since timestamp", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		http.Error(w, "Invalid until timestamp", http.StatusBadRequest)
+		return
+	}
+	if filter.Limit, err = parseIntParam(query.Get("limit")); err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if filter.Offset, err = parseIntParam(query.Get("offset")); err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := s.Repos.Workspace.GetByID(ctx, filter.WorkspaceID); err == nil {
+		if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+			return
+		}
+	} else if strings.Contains(err.Error(), "not found") {
+		owned, err := s.Repos.Audit.OwnedAtDeletion(ctx, filter.WorkspaceID, token.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get audit log: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !owned {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	page, err := s.Repos.Audit.List(ctx, filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// parseIntParam parses an optional integer query parameter, defaulting to 0.
+func parseIntParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type contextKey string
+
+const tokenContextKey contextKey = "apiToken"
+
+// ============================================================================
+// Authentication Middleware
+// ============================================================================
+
+// AuthMiddleware resolves an "Authorization: Bearer <token>" header to a
+// personal access token and enforces its scopes. Calendar feeds also take a
+// read-only token as the "token" parameter, since calendar apps subscribe by
+// URL alone, and CalDAV clients send the token as a Basic auth password.
+// Requests without a token pass through unauthenticated.
+func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		inURL := header == "" && isCalendarFeed(r) && r.URL.Query().Get("token") != ""
+		if header == "" && !inURL {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		challenge := unauthorized
+		plaintext, found := strings.CutPrefix(header, "Bearer ")
+		if inURL {
+			plaintext, found = r.URL.Query().Get("token"), true
+		}
+		if isCalDAV(r) {
+			challenge = basicUnauthorized
+			if _, password, ok := r.BasicAuth(); ok {
+				plaintext, found = password, true
+			}
+		}
+		if !found || plaintext == "" {
+			challenge(w, "Invalid authorization header")
+			return
+		}
+
+		ctx := context.Background()
+		token, err := s.Repos.Token.Authenticate(ctx, plaintext)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				challenge(w, "Invalid or revoked token")
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to authenticate: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if token.ReadOnly && !isSafeMethod(r.Method) {
+			http.Error(w, "Token is read-only", http.StatusForbidden)
+			return
+		}
+
+		// URLs end up in logs and calendar settings, so they may only carry
+		// tokens that cannot change anything
+		if inURL && !token.ReadOnly {
+			http.Error(w, "Only read-only tokens can be used in URLs", http.StatusForbidden)
+			return
+		}
+
+		if token.WorkspaceID != nil {
+			workspaceID, ok, err := s.requestWorkspaceID(ctx, r)
+			if err != nil && !strings.Contains(err.Error(), "not found") {
+				http.Error(w, fmt.Sprintf("Failed to resolve workspace: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if err == nil && !ok && !allowedForWorkspaceToken(r) {
+				http.Error(w, "Token is limited to a single workspace", http.StatusForbidden)
+				return
+			}
+			if ok && workspaceID != *token.WorkspaceID {
+				http.Error(w, "Token is limited to a single workspace", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, token)))
+	})
+}
+
+// requestToken returns the token the request was authenticated with, or nil.
+func requestToken(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(tokenContextKey).(*models.APIToken)
+	return token
+}
+
+// requestWorkspaceID resolves the workspace a request operates on from its
+// route. ok is false for routes that are not tied to a single workspace.
+func (s *Server) requestWorkspaceID(ctx context.Context, r *http.Request) (string, bool, error) {
+	vars := mux.Vars(r)
+	if workspaceID, found := vars["workspaceId"]; found {
+		return workspaceID, true, nil
+	}
+
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false, nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false, nil
+	}
+
+	switch {
+	case template == "/api/v1/audit":
+		return r.URL.Query().Get("workspaceId"), true, nil
+
+	case strings.HasPrefix(template, "/api/v1/workspaces/{id}"):
+		return vars["id"], true, nil
+
+	case strings.HasPrefix(template, "/api/v1/noteblocks/"):
+		idStr := vars["id"]
+		if idStr == "" {
+			idStr = vars["noteBlockId"]
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return "", false, fmt.Errorf("note block not found")
+		}
+		workspaceID, err := s.Repos.NoteBlock.GetWorkspaceID(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		return workspaceID, true, nil
+
+	case strings.HasPrefix(template, "/api/v1/notes/{id}"):
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			return "", false, fmt.Errorf("note not found")
+		}
+		workspaceID, err := s.Repos.Note.GetWorkspaceID(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		return workspaceID, true, nil
+	}
+
+	return "", false, nil
+}
+
+// allowedForWorkspaceToken reports whether a route that is not tied to a
+// workspace may be used with a workspace-limited token.
+func allowedForWorkspaceToken(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, _ := route.GetPathTemplate()
+
+	switch template {
+	case "/health", "/share/{token}", "/.well-known/caldav":
+		return true
+	case "/caldav/":
+		// Only the calendar of the token's workspace is listed
+		return true
+	case "/api/v1/users/me/calendar.ics":
+		// The feed only covers the token's workspace
+		return true
+	case "/api/v1/workspaces":
+		// Listing is filtered down to the token's workspace
+		return r.Method == http.MethodGet
+	}
+	return false
+}
+
+// isCalendarFeed reports whether a request is for an iCalendar feed.
+func isCalendarFeed(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, _ := route.GetPathTemplate()
+	return r.Method == http.MethodGet && strings.HasSuffix(template, "/calendar.ics")
+}
+
+// isCalDAV reports whether a request is for a CalDAV resource.
+func isCalDAV(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, _ := route.GetPathTemplate()
+	return strings.HasPrefix(template, calDAVRoot)
+}
+
+// isSafeMethod reports whether a method only reads, WebDAV ones included.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return true
+	}
+	return false
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nat"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// basicUnauthorized asks CalDAV clients, which do not support bearer tokens,
+// for Basic credentials.
+func basicUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="nat", charset="UTF-8"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// requireFullToken writes an error and returns nil unless the request is
+// authenticated with a token that is neither read-only nor workspace-limited.
+func requireFullToken(w http.ResponseWriter, r *http.Request) *models.APIToken {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return nil
+	}
+	if token.ReadOnly || token.WorkspaceID != nil {
+		http.Error(w, "Token management requires an unrestricted token", http.StatusForbidden)
+		return nil
+	}
+	return token
+}
+
+// ============================================================================
+// User Handlers
+// ============================================================================
+
+// HandleCreateUser registers a user and returns it together with a first,
+// unrestricted token that can be used to manage further tokens. User IDs are
+// always generated; an ID in the request is ignored.
+func (s *Server) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(user.Name) == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	token := models.APIToken{Name: "default"}
+	if err := s.Repos.User.Create(ctx, &user, &token); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":  user,
+		"token": token,
+	})
+}
+
+func (s *Server) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	user, err := s.Repos.User.GetByID(ctx, token.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ============================================================================
+// Token Handlers
+// ============================================================================
+
+func (s *Server) HandleGetTokens(w http.ResponseWriter, r *http.Request) {
+	caller := requireFullToken(w, r)
+	if caller == nil {
+		return
+	}
+
+	ctx := context.Background()
+	tokens, err := s.Repos.Token.GetByUserID(ctx, caller.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get tokens: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (s *Server) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	caller := requireFullToken(w, r)
+	if caller == nil {
+		return
+	}
+
+	var token models.APIToken
+	if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	token.UserID = caller.UserID // Tokens are always created for the caller
+
+	ctx := context.Background()
+	if token.WorkspaceID != nil {
+		if _, err := s.Repos.Workspace.GetByID(ctx, *token.WorkspaceID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, "Workspace not found", http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	if err := s.Repos.Token.Create(ctx, &token); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+func (s *Server) HandleRenameToken(w http.ResponseWriter, r *http.Request) {
+	caller := requireFullToken(w, r)
+	if caller == nil {
+		return
+	}
+
+	id, ok := s.callerTokenID(w, r, caller)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Token.Rename(ctx, id, body.Name); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to rename token: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	token, err := s.Repos.Token.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get updated token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+func (s *Server) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	caller := requireFullToken(w, r)
+	if caller == nil {
+		return
+	}
+
+	id, ok := s.callerTokenID(w, r, caller)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Token.Revoke(ctx, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to revoke token: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// callerTokenID parses the {id} route variable and checks that the token it
+// refers to belongs to the caller. Tokens of other users are reported as not
+// found so their existence is not revealed.
+func (s *Server) callerTokenID(w http.ResponseWriter, r *http.Request, caller *models.APIToken) (int64, bool) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	ctx := context.Background()
+	token, err := s.Repos.Token.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get token: %v", err), http.StatusInternalServerError)
+		}
+		return 0, false
+	}
+
+	if token.UserID != caller.UserID {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return 0, false
+	}
+
+	return id, true
+}
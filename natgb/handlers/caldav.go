@@ -0,0 +1,864 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// CalDAV serves each workspace as a calendar of tasks and its notes as VTODO
+// resources:
+//
+//	/caldav/                      principal and calendar home of the caller
+//	/caldav/{workspaceId}/        calendar of a workspace
+//	/caldav/{workspaceId}/{name}  VTODO of a note
+//
+// Clients sign in with HTTP Basic auth and an API token as the password.
+// Notes created by a client keep the name and UID it gave them; the others
+// are "note-{id}.ics".
+const calDAVRoot = "/caldav/"
+
+// calDAVCompliance is the DAV header of CalDAV resources.
+const calDAVCompliance = "1, 3, calendar-access"
+
+// XML namespaces of WebDAV, CalDAV and the calendarserver.org extensions.
+const (
+	davNS       = "DAV:"
+	calDAVNS    = "urn:ietf:params:xml:ns:caldav"
+	calServerNS = "http://calendarserver.org/ns/"
+)
+
+var calendarDataName = xml.Name{Space: calDAVNS, Local: "calendar-data"}
+
+func calendarHref(workspaceID string) string {
+	return calDAVRoot + url.PathEscape(workspaceID) + "/"
+}
+
+func calendarObjectHref(workspaceID, name string) string {
+	return calendarHref(workspaceID) + url.PathEscape(name)
+}
+
+// noteETag changes whenever the note does.
+func noteETag(note models.Note) string {
+	return fmt.Sprintf(`"%d-%d"`, note.ID, note.Metadata.Updated.UnixNano())
+}
+
+// calendarTag changes whenever a note of the workspace is added, changed or
+// removed.
+func calendarTag(workspace *models.Workspace) string {
+	count, latest := 0, int64(0)
+	for _, noteBlock := range workspace.Data.NoteBlocks {
+		for _, note := range noteBlock.Notes {
+			count++
+			if updated := note.Metadata.Updated.UnixNano(); updated > latest {
+				latest = updated
+			}
+		}
+	}
+	return fmt.Sprintf(`"%d-%d"`, count, latest)
+}
+
+// noteCalendar renders a note as a calendar of a single VTODO. It is stamped
+// with the last change of the note, so that it only changes with the note.
+func noteCalendar(note models.Note, uid string, vocabulary *noteVocabulary) []byte {
+	calendar := &icalWriter{}
+	calendar.beginCalendar("")
+	calendar.todo(note, uid, vocabulary, note.Metadata.Updated)
+	calendar.endCalendar()
+	return calendar.Bytes()
+}
+
+func xmlEscape(value string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+func davHref(href string) string {
+	return `<href xmlns="DAV:">` + xmlEscape(href) + `</href>`
+}
+
+// ============================================================================
+// WebDAV Properties
+// ============================================================================
+
+// davProperty is a property with its value as XML.
+type davProperty struct {
+	name  xml.Name
+	value string
+}
+
+// davResource is a resource with the properties it has.
+type davResource struct {
+	href       string
+	properties []davProperty
+}
+
+func (r *davResource) set(space, local, value string) {
+	r.properties = append(r.properties, davProperty{xml.Name{Space: space, Local: local}, value})
+}
+
+// davPropNames reads the names of the children of a prop element.
+type davPropNames []xml.Name
+
+func (n *davPropNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			*n = append(*n, token.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// davPropRequest lists the properties a PROPFIND or REPORT asks for. all
+// selects every property but the calendar data, names their names alone.
+type davPropRequest struct {
+	all   bool
+	names bool
+	props davPropNames
+}
+
+type davPropfind struct {
+	AllProp  *struct{}    `xml:"DAV: allprop"`
+	PropName *struct{}    `xml:"DAV: propname"`
+	Prop     davPropNames `xml:"DAV: prop"`
+}
+
+// readPropfind reads the body of a PROPFIND. An empty body asks for all
+// properties.
+func readPropfind(w http.ResponseWriter, r *http.Request) (davPropRequest, bool) {
+	document, ok := readDocument(w, r)
+	if !ok {
+		return davPropRequest{}, false
+	}
+	if len(bytes.TrimSpace(document)) == 0 {
+		return davPropRequest{all: true}, true
+	}
+
+	var propfind davPropfind
+	if err := xml.Unmarshal(document, &propfind); err != nil {
+		http.Error(w, "Invalid XML", http.StatusBadRequest)
+		return davPropRequest{}, false
+	}
+	return davPropRequest{all: propfind.AllProp != nil, names: propfind.PropName != nil, props: propfind.Prop}, true
+}
+
+// multistatus collects the responses of a 207 Multi-Status.
+type multistatus struct {
+	bytes.Buffer
+}
+
+func newMultistatus() *multistatus {
+	m := &multistatus{}
+	m.WriteString(xml.Header + `<multistatus xmlns="DAV:">`)
+	return m
+}
+
+// resource adds the requested properties of a resource, listing those it
+// does not have as not found.
+func (m *multistatus) resource(resource *davResource, request davPropRequest) {
+	var found, missing []davProperty
+	if request.all || request.names {
+		for _, property := range resource.properties {
+			if property.name == calendarDataName {
+				continue
+			}
+			if request.names {
+				property.value = ""
+			}
+			found = append(found, property)
+		}
+	} else {
+	requested:
+		for _, name := range request.props {
+			for _, property := range resource.properties {
+				if property.name == name {
+					found = append(found, property)
+					continue requested
+				}
+			}
+			missing = append(missing, davProperty{name: name})
+		}
+	}
+
+	m.WriteString("<response>" + davHref(resource.href))
+	m.propstat(found, http.StatusOK)
+	m.propstat(missing, http.StatusNotFound)
+	m.WriteString("</response>")
+}
+
+func (m *multistatus) propstat(properties []davProperty, status int) {
+	if len(properties) == 0 {
+		return
+	}
+	m.WriteString("<propstat><prop>")
+	for _, property := range properties {
+		fmt.Fprintf(m, `<%s xmlns="%s">%s</%s>`, property.name.Local, xmlEscape(property.name.Space), property.value, property.name.Local)
+	}
+	m.WriteString("</prop>")
+	m.status(status)
+	m.WriteString("</propstat>")
+}
+
+// missing adds the response of an href that does not exist.
+func (m *multistatus) missing(href string) {
+	m.WriteString("<response>" + davHref(href))
+	m.status(http.StatusNotFound)
+	m.WriteString("</response>")
+}
+
+func (m *multistatus) status(status int) {
+	fmt.Fprintf(m, "<status>HTTP/1.1 %d %s</status>", status, http.StatusText(status))
+}
+
+func (m *multistatus) write(w http.ResponseWriter) {
+	m.WriteString("</multistatus>")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(m.Bytes())
+}
+
+// calDAVHome describes the root, which is both the principal of the caller
+// and the home of their calendars.
+func calDAVHome(user *models.User) *davResource {
+	home := &davResource{href: calDAVRoot}
+	home.set(davNS, "resourcetype", `<collection/><principal/>`)
+	home.set(davNS, "displayname", xmlEscape(user.Name))
+	home.set(davNS, "current-user-principal", davHref(calDAVRoot))
+	home.set(davNS, "principal-URL", davHref(calDAVRoot))
+	home.set(calDAVNS, "calendar-home-set", davHref(calDAVRoot))
+	return home
+}
+
+// calDAVCalendar describes the calendar of a workspace, loaded with its
+// notes. Only editors with a writable token may change it.
+func (s *Server) calDAVCalendar(ctx context.Context, token *models.APIToken, workspace *models.Workspace) (*davResource, error) {
+	member, err := s.workspaceMember(ctx, workspace.ID, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	privileges := `<privilege><read/></privilege>`
+	if roleRanks[member.Role] >= roleRanks[models.RoleEditor] && !token.ReadOnly {
+		privileges += `<privilege><write/></privilege>`
+	}
+
+	tag := xmlEscape(calendarTag(workspace))
+	calendar := &davResource{href: calendarHref(workspace.ID)}
+	calendar.set(davNS, "resourcetype", `<collection/><calendar xmlns="urn:ietf:params:xml:ns:caldav"/>`)
+	calendar.set(davNS, "displayname", xmlEscape(workspace.Name))
+	calendar.set(davNS, "getetag", tag)
+	calendar.set(calServerNS, "getctag", tag)
+	calendar.set(davNS, "current-user-principal", davHref(calDAVRoot))
+	calendar.set(davNS, "current-user-privilege-set", privileges)
+	calendar.set(davNS, "supported-report-set",
+		`<supported-report><report><calendar-query xmlns="urn:ietf:params:xml:ns:caldav"/></report></supported-report>`+
+			`<supported-report><report><calendar-multiget xmlns="urn:ietf:params:xml:ns:caldav"/></report></supported-report>`)
+	calendar.set(calDAVNS, "supported-calendar-component-set", `<comp name="VTODO"/>`)
+	return calendar, nil
+}
+
+// calDAVObject describes the VTODO of a note.
+func calDAVObject(workspaceID string, note models.Note, object models.CalendarObject, vocabulary *noteVocabulary) *davResource {
+	resource := &davResource{href: calendarObjectHref(workspaceID, object.Name)}
+	resource.set(davNS, "resourcetype", "")
+	resource.set(davNS, "getetag", xmlEscape(noteETag(note)))
+	resource.set(davNS, "getcontenttype", "text/calendar; charset=utf-8; component=VTODO")
+	resource.set(davNS, "getlastmodified", note.Metadata.Updated.UTC().Format(http.TimeFormat))
+	resource.set(calDAVNS, "calendar-data", xmlEscape(string(noteCalendar(note, object.UID, vocabulary))))
+	return resource
+}
+
+// findCalendarObject finds a calendar object of a workspace by name. Notes
+// named by a client are only found under that name.
+func (s *Server) findCalendarObject(ctx context.Context, workspaceID, name string) (*models.CalendarObject, error) {
+	object, err := s.Repos.CalendarObject.GetByName(ctx, workspaceID, name)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		return object, err
+	}
+
+	var id int64
+	if _, err := fmt.Sscanf(name, "note-%d.ics", &id); err != nil || name != fmt.Sprintf("note-%d.ics", id) {
+		return nil, fmt.Errorf("calendar object not found")
+	}
+	noteWorkspaceID, err := s.Repos.Note.GetWorkspaceID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("calendar object not found")
+		}
+		return nil, err
+	}
+	if noteWorkspaceID != workspaceID {
+		return nil, fmt.Errorf("calendar object not found")
+	}
+
+	objects, err := s.Repos.CalendarObject.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := objects[id]; ok {
+		return nil, fmt.Errorf("calendar object not found")
+	}
+	object = &models.CalendarObject{NoteID: id, Name: name, UID: noteUID(id)}
+	return object, nil
+}
+
+// calendarPreconditions checks If-Match and If-None-Match against the ETag
+// of a resource, "" if it does not exist yet.
+func calendarPreconditions(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if etag == "" || (match != "*" && !etagMatches(match, etag)) {
+			http.Error(w, "Resource has changed", http.StatusPreconditionFailed)
+			return false
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && etag != "" {
+		if noneMatch == "*" || etagMatches(noneMatch, etag) {
+			http.Error(w, "Resource already exists", http.StatusPreconditionFailed)
+			return false
+		}
+	}
+	return true
+}
+
+// etagMatches reports whether a list of ETags holds one, ignoring weakness.
+func etagMatches(list, etag string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(item), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarNoteBlock returns the note block new tasks go to: the first one of
+// the workspace, or a new "Inbox".
+func (s *Server) calendarNoteBlock(w http.ResponseWriter, r *http.Request, workspaceID string) (int64, bool) {
+	ctx := context.Background()
+	noteBlocks, err := s.Repos.NoteBlock.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note blocks: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	if len(noteBlocks) > 0 {
+		return noteBlocks[0].ID, true
+	}
+
+	noteBlock := models.NoteBlock{Head: todoTxtDefaultBlock}
+	if err := s.Repos.NoteBlock.Create(ctx, &noteBlock, workspaceID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create note block: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(noteBlock.ID), Action: models.ActionCreate,
+	}, nil, noteBlock)
+
+	return noteBlock.ID, true
+}
+
+// authorizeCalDAV is authorize for CalDAV clients, which are asked for Basic
+// credentials.
+func (s *Server) authorizeCalDAV(w http.ResponseWriter, r *http.Request, role string) (string, bool) {
+	if requestToken(r) == nil {
+		basicUnauthorized(w, "Authentication required")
+		return "", false
+	}
+	return s.authorize(w, r, role)
+}
+
+// ============================================================================
+// CalDAV Handlers
+// ============================================================================
+
+// HandleCalDAVWellKnown points clients discovering the server to the root.
+func (s *Server) HandleCalDAVWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, calDAVRoot, http.StatusMovedPermanently)
+}
+
+// HandleCalDAVOptions announces CalDAV support.
+func (s *Server) HandleCalDAVOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", calDAVCompliance)
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePropfindCalDAVHome describes the root and, unless the depth is 0,
+// the calendars of the workspaces the caller can read.
+func (s *Server) HandlePropfindCalDAVHome(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		basicUnauthorized(w, "Authentication required")
+		return
+	}
+
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	user, err := s.Repos.User.GetByID(ctx, token.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := newMultistatus()
+	response.resource(calDAVHome(user), request)
+
+	if r.Header.Get("Depth") != "0" {
+		workspaceIDs, err := s.visibleWorkspaces(ctx, token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, id := range workspaceIDs {
+			workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+				return
+			}
+			calendar, err := s.calDAVCalendar(ctx, token, workspace)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get membership: %v", err), http.StatusInternalServerError)
+				return
+			}
+			response.resource(calendar, request)
+		}
+	}
+
+	response.write(w)
+}
+
+// HandlePropfindCalendar describes the calendar of a workspace and, unless
+// the depth is 0, the VTODOs of its notes.
+func (s *Server) HandlePropfindCalendar(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, workspaceID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	calendar, err := s.calDAVCalendar(ctx, requestToken(r), workspace)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get membership: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := newMultistatus()
+	response.resource(calendar, request)
+
+	if r.Header.Get("Depth") != "0" {
+		vocabulary, err := s.noteVocabulary(ctx, workspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		objects, err := s.Repos.CalendarObject.GetByWorkspaceID(ctx, workspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get calendar objects: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, noteBlock := range workspace.Data.NoteBlocks {
+			for _, note := range noteBlock.Notes {
+				response.resource(calDAVObject(workspaceID, note, noteCalendarObject(note.ID, objects), vocabulary), request)
+			}
+		}
+	}
+
+	response.write(w)
+}
+
+// calendarReport is the body of a calendar-query or calendar-multiget report.
+type calendarReport struct {
+	XMLName xml.Name
+	AllProp *struct{}    `xml:"DAV: allprop"`
+	Prop    davPropNames `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+	Filter  struct {
+		Comp calendarCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type calendarCompFilter struct {
+	Name  string               `xml:"name,attr"`
+	Comps []calendarCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// matchesTodos reports whether a calendar-query filter can match VTODOs.
+// Only components are filtered on; time ranges and properties are not.
+func (f calendarCompFilter) matchesTodos() bool {
+	if len(f.Comps) == 0 {
+		return true
+	}
+	for _, comp := range f.Comps {
+		if strings.EqualFold(comp.Name, "VTODO") {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleReportCalendar answers calendar-multiget reports, which fetch
+// VTODOs by href, and calendar-query reports, which list all of them.
+func (s *Server) HandleReportCalendar(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	document, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	var report calendarReport
+	if err := xml.Unmarshal(document, &report); err != nil {
+		http.Error(w, "Invalid XML", http.StatusBadRequest)
+		return
+	}
+	request := davPropRequest{all: report.AllProp != nil, props: report.Prop}
+
+	ctx := context.Background()
+	vocabulary, err := s.noteVocabulary(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	objects, err := s.Repos.CalendarObject.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get calendar objects: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := newMultistatus()
+	switch report.XMLName {
+	case xml.Name{Space: calDAVNS, Local: "calendar-multiget"}:
+		prefix, _ := url.PathUnescape(calendarHref(workspaceID))
+		for _, href := range report.Hrefs {
+			href = strings.TrimSpace(href)
+			// Hrefs may be absolute URLs
+			parsed, err := url.Parse(href)
+			if err != nil {
+				response.missing(href)
+				continue
+			}
+			name, found := strings.CutPrefix(parsed.Path, prefix)
+			if !found || name == "" || strings.Contains(name, "/") {
+				response.missing(href)
+				continue
+			}
+
+			object, err := s.findCalendarObject(ctx, workspaceID, name)
+			var note *models.Note
+			if err == nil {
+				note, err = s.Repos.Note.GetByID(ctx, object.NoteID)
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					response.missing(href)
+					continue
+				}
+				http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+				return
+			}
+			response.resource(calDAVObject(workspaceID, *note, *object, vocabulary), request)
+		}
+
+	case xml.Name{Space: calDAVNS, Local: "calendar-query"}:
+		if !report.Filter.Comp.matchesTodos() {
+			break
+		}
+		workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, workspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, noteBlock := range workspace.Data.NoteBlocks {
+			for _, note := range noteBlock.Notes {
+				response.resource(calDAVObject(workspaceID, note, noteCalendarObject(note.ID, objects), vocabulary), request)
+			}
+		}
+
+	default:
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return
+	}
+
+	response.write(w)
+}
+
+// HandlePropfindCalendarObject describes the VTODO of a note.
+func (s *Server) HandlePropfindCalendarObject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	note, object, ok := s.calendarObjectNote(w, workspaceID, name)
+	if !ok {
+		return
+	}
+	vocabulary, err := s.noteVocabulary(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := newMultistatus()
+	response.resource(calDAVObject(workspaceID, *note, *object, vocabulary), request)
+	response.write(w)
+}
+
+// calendarObjectNote loads the note of a calendar object.
+func (s *Server) calendarObjectNote(w http.ResponseWriter, workspaceID, name string) (*models.Note, *models.CalendarObject, bool) {
+	ctx := context.Background()
+	object, err := s.findCalendarObject(ctx, workspaceID, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Calendar object not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get calendar object: %v", err), http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+
+	note, err := s.Repos.Note.GetByID(ctx, object.NoteID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return note, object, true
+}
+
+// HandleGetCalendarObject serves the VTODO of a note.
+func (s *Server) HandleGetCalendarObject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	note, object, ok := s.calendarObjectNote(w, workspaceID, name)
+	if !ok {
+		return
+	}
+	vocabulary, err := s.noteVocabulary(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", noteETag(*note))
+	w.Write(noteCalendar(*note, object.UID, vocabulary))
+}
+
+// HandlePutCalendarObject creates or replaces the note of a VTODO. New notes
+// go to the first note block. Updates keep the status of a note unless its
+// completion changes, and its priority if the client kept it.
+func (s *Server) HandlePutCalendarObject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	document, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	todo, _, err := parseICalendar(document)
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+	if todo == nil {
+		http.Error(w, "Only VTODO components are supported", http.StatusForbidden)
+		return
+	}
+	if todo.UID == "" {
+		http.Error(w, "UID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	object, err := s.findCalendarObject(ctx, workspaceID, name)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		http.Error(w, fmt.Sprintf("Failed to get calendar object: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var before *models.Note
+	etag := ""
+	if object != nil {
+		if before, err = s.Repos.Note.GetByID(ctx, object.NoteID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+			return
+		}
+		etag = noteETag(*before)
+	}
+	if !calendarPreconditions(w, r, etag) {
+		return
+	}
+
+	objects, err := s.Repos.CalendarObject.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get calendar objects: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, other := range objects {
+		if other.UID == todo.UID && (object == nil || other.NoteID != object.NoteID) {
+			http.Error(w, "UID is used by another calendar object", http.StatusConflict)
+			return
+		}
+	}
+
+	vocabulary, err := s.noteVocabulary(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var note models.Note
+	if before != nil {
+		note = *before
+	}
+	note.Head = todo.Summary
+	note.Note = todo.Description
+	note.Tags = append([]string{}, todo.Categories...)
+	if before == nil || icalPriority(before.Priority, vocabulary) != todo.Priority {
+		note.Priority = notePriority(todo.Priority, vocabulary)
+	}
+	completed := todo.Completed
+	note.Metadata.Completed = &completed
+	note.Metadata.CompletedAt = todo.CompletedAt
+	note.Metadata.Due = todo.Due
+
+	if before == nil {
+		if todo.Created != nil {
+			note.Metadata.Created = *todo.Created
+		}
+
+		noteBlockID, ok := s.calendarNoteBlock(w, r, workspaceID)
+		if !ok {
+			return
+		}
+		if err := s.Repos.Note.Create(ctx, &note, noteBlockID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create note: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(note.ID), Action: models.ActionCreate,
+		}, nil, note)
+	} else {
+		if err := s.Repos.Note.Update(ctx, &note); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, "Note not found", http.StatusNotFound)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to update note: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(note.ID), Action: models.ActionUpdate,
+		}, before, note)
+	}
+
+	if err := s.Repos.CalendarObject.Set(ctx, &models.CalendarObject{NoteID: note.ID, Name: name, UID: todo.UID}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to set calendar object: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The stored VTODO is not the one sent, so no ETag is returned and
+	// clients fetch it again
+	if before == nil {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleDeleteCalendarObject deletes the note of a VTODO.
+func (s *Server) HandleDeleteCalendarObject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	workspaceID, ok := s.authorizeCalDAV(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	before, _, ok := s.calendarObjectNote(w, workspaceID, name)
+	if !ok {
+		return
+	}
+	if !calendarPreconditions(w, r, noteETag(*before)) {
+		return
+	}
+
+	if err := s.Repos.Note.Delete(ctx, before.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Note not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete note: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.purgeBlobs(ctx)
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(before.ID), Action: models.ActionDelete,
+	}, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
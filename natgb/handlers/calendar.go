@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// iCalendar timestamps are in UTC; dates stand for whole days.
+const (
+	icalTime = "20060102T150405Z"
+	icalDate = "20060102"
+)
+
+// icalWriter writes iCalendar content lines, folded at 75 octets and ended
+// with CRLF as RFC 5545 requires.
+type icalWriter struct {
+	bytes.Buffer
+}
+
+func (w *icalWriter) line(name, value string) {
+	line := name + ":" + value
+	// Continuation lines start with a space, which counts towards their length
+	limit := 75
+	for len(line) > limit {
+		// Fold between characters, never inside one
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func (w *icalWriter) text(name, value string) {
+	w.line(name, icalEscape(value))
+}
+
+func (w *icalWriter) time(name string, value time.Time) {
+	w.line(name, value.UTC().Format(icalTime))
+}
+
+// icalEscape escapes a TEXT value.
+var icalEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
+
+// noteUID is the stable UID of the VTODO of a note, unless a CalDAV client
+// created it with a UID of its own.
+func noteUID(id int64) string {
+	return fmt.Sprintf("note-%d@nat", id)
+}
+
+// noteCalendarObject returns the calendar object of a note among those of
+// its workspace. Notes no CalDAV client has named are "note-{id}.ics".
+func noteCalendarObject(id int64, objects map[int64]models.CalendarObject) models.CalendarObject {
+	if object, ok := objects[id]; ok {
+		return object
+	}
+	return models.CalendarObject{NoteID: id, Name: fmt.Sprintf("note-%d.ics", id), UID: noteUID(id)}
+}
+
+// icalPriority spreads the priorities of a workspace over the iCalendar
+// range, where 1 is the most urgent and 9 the least; 0 is undefined.
+func icalPriority(priority string, vocabulary *noteVocabulary) int {
+	n := len(vocabulary.ranked)
+	for i, name := range vocabulary.ranked {
+		if name != priority {
+			continue
+		}
+		if n == 1 {
+			return 5
+		}
+		return 1 + (8*i+(n-1)/2)/(n-1)
+	}
+	return 0
+}
+
+// notePriority is the inverse of icalPriority: the priority of the workspace
+// closest to an iCalendar priority, or "" for 0.
+func notePriority(priority int, vocabulary *noteVocabulary) string {
+	if priority <= 0 {
+		return ""
+	}
+	best, distance := "", 0
+	for _, name := range vocabulary.ranked {
+		d := icalPriority(name, vocabulary) - priority
+		if d < 0 {
+			d = -d
+		}
+		if best == "" || d < distance {
+			best, distance = name, d
+		}
+	}
+	return best
+}
+
+// beginCalendar starts a calendar of VTODO components.
+func (w *icalWriter) beginCalendar(name string) {
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//nat//natgb//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	if name != "" {
+		w.text("X-WR-CALNAME", name)
+	}
+}
+
+func (w *icalWriter) endCalendar() {
+	w.line("END", "VCALENDAR")
+}
+
+// todo writes a note as a VTODO. Due dates at midnight are written as dates.
+func (w *icalWriter) todo(note models.Note, uid string, vocabulary *noteVocabulary, stamp time.Time) {
+	w.line("BEGIN", "VTODO")
+	w.text("UID", uid)
+	w.time("DTSTAMP", stamp)
+	w.time("CREATED", note.Metadata.Created)
+	w.time("LAST-MODIFIED", note.Metadata.Updated)
+	w.text("SUMMARY", note.Head)
+	if note.Note != "" {
+		w.text("DESCRIPTION", note.Note)
+	}
+	if priority := icalPriority(note.Priority, vocabulary); priority != 0 {
+		w.line("PRIORITY", fmt.Sprint(priority))
+	}
+	if len(note.Tags) > 0 {
+		categories := make([]string, len(note.Tags))
+		for i, tag := range note.Tags {
+			categories[i] = icalEscape(tag)
+		}
+		w.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if due := note.Metadata.Due; due != nil {
+		if due.Hour() == 0 && due.Minute() == 0 && due.Second() == 0 {
+			w.line("DUE;VALUE=DATE", due.Format(icalDate))
+		} else {
+			w.time("DUE", *due)
+		}
+	}
+	if note.Metadata.Completed != nil && *note.Metadata.Completed {
+		w.line("STATUS", "COMPLETED")
+		w.line("PERCENT-COMPLETE", "100")
+		if note.Metadata.CompletedAt != nil {
+			w.time("COMPLETED", *note.Metadata.CompletedAt)
+		}
+	} else {
+		w.line("STATUS", "NEEDS-ACTION")
+	}
+	w.line("END", "VTODO")
+}
+
+// writeWorkspaceTodos writes the notes of a workspace as VTODOs.
+func (s *Server) writeWorkspaceTodos(ctx context.Context, w *icalWriter, workspace *models.Workspace, stamp time.Time) error {
+	vocabulary, err := s.noteVocabulary(ctx, workspace.ID)
+	if err != nil {
+		return err
+	}
+	objects, err := s.Repos.CalendarObject.GetByWorkspaceID(ctx, workspace.ID)
+	if err != nil {
+		return err
+	}
+	for _, noteBlock := range workspace.Data.NoteBlocks {
+		for _, note := range noteBlock.Notes {
+			w.todo(note, noteCalendarObject(note.ID, objects).UID, vocabulary, stamp)
+		}
+	}
+	return nil
+}
+
+// icalProperty is a content line of an iCalendar document.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// icalTodo is a VTODO read from an iCalendar document.
+type icalTodo struct {
+	UID         string
+	Summary     string
+	Description string
+	Priority    int
+	Categories  []string
+	Created     *time.Time
+	Due         *time.Time
+	Completed   bool
+	CompletedAt *time.Time
+}
+
+// icalUnescape reverses icalEscape.
+var icalUnescape = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace
+
+// parseICalendar reads the first VTODO of an iCalendar document. Properties
+// of components nested in it, like alarms, are skipped. Documents without a
+// VTODO report the components they have instead.
+func parseICalendar(document []byte) (*icalTodo, []string, error) {
+	// Unfold continuation lines first
+	var lines []string
+	for _, line := range strings.Split(string(document), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var todo *icalTodo
+	var components, stack []string
+	reading := false
+	for _, line := range lines {
+		property, err := parseICalendarLine(line)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch property.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(property.value))
+			if len(stack) == 2 {
+				components = append(components, stack[1])
+				reading = stack[1] == "VTODO" && todo == nil
+				if reading {
+					todo = &icalTodo{}
+				}
+			}
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(property.value) {
+				return nil, nil, fmt.Errorf("unexpected END:%s", property.value)
+			}
+			if len(stack) == 2 {
+				reading = false
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if !reading || len(stack) != 2 {
+				continue
+			}
+			if err := todo.set(property); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", property.name, err)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, nil, fmt.Errorf("missing END:%s", stack[len(stack)-1])
+	}
+
+	return todo, components, nil
+}
+
+// parseICalendarLine splits a content line into its name, parameters and
+// value. Quoted parameter values may contain colons and semicolons.
+func parseICalendarLine(line string) (icalProperty, error) {
+	property := icalProperty{params: map[string]string{}}
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ';' || c == ':':
+			part := line[start:i]
+			if start == 0 {
+				property.name = strings.ToUpper(part)
+			} else if key, value, ok := strings.Cut(part, "="); ok {
+				property.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			if c == ':' && property.name != "" {
+				property.value = line[i+1:]
+				return property, nil
+			}
+			start = i + 1
+		}
+	}
+	return property, fmt.Errorf("invalid line %q", line)
+}
+
+// set reads a property of a VTODO.
+func (todo *icalTodo) set(property icalProperty) error {
+	var err error
+	switch property.name {
+	case "UID":
+		todo.UID = icalUnescape(property.value)
+	case "SUMMARY":
+		todo.Summary = icalUnescape(property.value)
+	case "DESCRIPTION":
+		todo.Description = icalUnescape(property.value)
+	case "PRIORITY":
+		if todo.Priority, err = strconv.Atoi(property.value); err != nil || todo.Priority < 0 || todo.Priority > 9 {
+			return fmt.Errorf("expected 0 to 9")
+		}
+	case "CATEGORIES":
+		for _, category := range splitICalendarList(property.value) {
+			if category = strings.TrimSpace(icalUnescape(category)); category != "" {
+				todo.Categories = append(todo.Categories, category)
+			}
+		}
+	case "STATUS":
+		todo.Completed = strings.EqualFold(property.value, "COMPLETED")
+	case "CREATED":
+		todo.Created, err = parseICalendarTime(property)
+	case "DUE":
+		todo.Due, err = parseICalendarTime(property)
+	case "COMPLETED":
+		if todo.CompletedAt, err = parseICalendarTime(property); err == nil {
+			todo.Completed = true
+		}
+	}
+	return err
+}
+
+// splitICalendarList splits a value at the commas that are not escaped.
+func splitICalendarList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, value[start:])
+}
+
+// parseICalendarTime reads a DATE or DATE-TIME value. Dates and floating
+// times are in server local time, as are times in unknown time zones.
+func parseICalendarTime(property icalProperty) (*time.Time, error) {
+	location := time.Local
+	if tzid := property.params["TZID"]; tzid != "" {
+		if loaded, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			location = loaded
+		}
+	}
+
+	for _, layout := range []string{icalTime, "20060102T150405", icalDate} {
+		if parsed, err := time.ParseInLocation(layout, property.value, location); err == nil {
+			if layout == icalDate {
+				parsed = time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.Local)
+			}
+			return &parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a date or time, got %q", property.value)
+}
+
+// ============================================================================
+// Calendar Handlers
+// ============================================================================
+
+// HandleGetWorkspaceCalendar serves the notes of a workspace as an iCalendar
+// feed of VTODOs, for calendar apps to subscribe to.
+func (s *Server) HandleGetWorkspaceCalendar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	calendar := &icalWriter{}
+	calendar.beginCalendar(workspace.Name)
+	if err := s.writeWorkspaceTodos(ctx, calendar, workspace, time.Now()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	calendar.endCalendar()
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(calendar.Bytes())
+}
+
+// HandleGetUserCalendar serves the notes of all workspaces the caller can
+// read as one iCalendar feed.
+func (s *Server) HandleGetUserCalendar(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	user, err := s.Repos.User.GetByID(ctx, token.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	workspaceIDs, err := s.visibleWorkspaces(ctx, token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	calendar := &icalWriter{}
+	calendar.beginCalendar(user.Name)
+	stamp := time.Now()
+	for _, id := range workspaceIDs {
+		workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+		if err == nil {
+			err = s.writeWorkspaceTodos(ctx, calendar, workspace, stamp)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	calendar.endCalendar()
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(calendar.Bytes())
+}
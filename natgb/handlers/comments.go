@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// commentRequest is the body of new and edited comments. Only new comments
+// may answer another one.
+type commentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int64 `json:"parentId"`
+}
+
+// noteComment loads a comment of the note in the route. Comments of other
+// notes and deleted comments are reported as not found.
+func (s *Server) noteComment(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	vars := mux.Vars(r)
+	noteID, _ := strconv.ParseInt(vars["id"], 10, 64)
+
+	id, err := strconv.ParseInt(vars["commentId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	comment, err := s.Repos.Comment.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get comment: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	if comment.NoteID != noteID || comment.Deleted != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// isAuthor tells whether the token's user wrote a comment.
+func isAuthor(token *models.APIToken, comment *models.Comment) bool {
+	return token != nil && comment.AuthorID != nil && *comment.AuthorID == token.UserID
+}
+
+// ============================================================================
+// Comment Handlers
+// ============================================================================
+
+// HandleGetComments returns the comment threads of a note, oldest first, with
+// replies nested under the comment they answer.
+func (s *Server) HandleGetComments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	comments, err := s.Repos.Comment.GetByNoteID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get comments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+// HandleCreateComment adds a comment by the caller, or a reply with
+// "parentId". Requires the commenter role.
+func (s *Server) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		http.Error(w, "Body is required", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleCommenter)
+	if !ok {
+		return
+	}
+
+	token := requestToken(r)
+	comment := models.Comment{NoteID: id, ParentID: request.ParentID, AuthorID: &token.UserID, Body: body}
+
+	ctx := context.Background()
+	if err := s.Repos.Comment.Create(ctx, &comment); err != nil {
+		if strings.Contains(err.Error(), "parent comment not found") {
+			http.Error(w, "Parent comment not found", http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to create comment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityComment, EntityID: formatID(comment.ID), Action: models.ActionCreate,
+	}, nil, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// HandleUpdateComment replaces the body of a comment. Only its author may
+// edit it.
+func (s *Server) HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		http.Error(w, "Body is required", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleCommenter)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	before, ok := s.noteComment(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	if !isAuthor(requestToken(r), before) {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	comment := *before
+	comment.Body = body
+	if err := s.Repos.Comment.Update(ctx, &comment); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update comment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityComment, EntityID: formatID(comment.ID), Action: models.ActionUpdate,
+	}, before, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// HandleDeleteComment deletes a comment, keeping its replies. Authors may
+// delete their comments; editors may delete any.
+func (s *Server) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleCommenter)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	comment, ok := s.noteComment(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	token := requestToken(r)
+	if !isAuthor(token, comment) && !s.authorizeWorkspace(w, token, workspaceID, models.RoleEditor) {
+		return
+	}
+
+	if err := s.Repos.Comment.Delete(ctx, comment.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete comment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityComment, EntityID: formatID(comment.ID), Action: models.ActionDelete,
+	}, comment, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
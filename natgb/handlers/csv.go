@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// csvExportColumns are the columns of CSV exports, in order.
+var csvExportColumns = []string{
+	"workspace", "block", "id", "head", "note", "priority", "completed", "created", "updated", "status", "tags", "due",
+}
+
+// csvImportFields are the note fields CSV columns can be mapped to. Columns
+// named after a field are mapped to it unless mapped otherwise.
+var csvImportFields = map[string]bool{
+	"block": true, "head": true, "note": true, "priority": true, "status": true,
+	"tags": true, "completed": true, "created": true, "updated": true, "due": true,
+}
+
+// csvDefaultBlock holds the imported notes that name no note block.
+const csvDefaultBlock = "Imported"
+
+// csvPageSize is how many notes exports read at a time.
+const csvPageSize = 200
+
+// csvEscapedPrefixes are the first characters of cells escaped in exports.
+const csvEscapedPrefixes = "=+-@\t\r'"
+
+// escapeCSVCell keeps spreadsheets from running a cell as a formula by
+// prefixing cells that start like one with a quote. Cells that already start
+// with a quote get one too, so that imports can drop exactly one.
+func escapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune(csvEscapedPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVCell undoes escapeCSVCell, dropping the quote of a cell that
+// starts like a formula after it.
+func unescapeCSVCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvEscapedPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// csvMapping maps the columns of a CSV document to note fields.
+type csvMapping struct {
+	fields  map[string]int // Note field to column index
+	headers []string
+}
+
+// newCSVMapping maps the header to note fields, first by the explicit
+// "header:field" mappings, where an empty field ignores the column, then by
+// the names of the remaining columns.
+func newCSVMapping(header []string, mappings []string) (*csvMapping, error) {
+	mapping := &csvMapping{fields: map[string]int{}, headers: header}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	mapped := map[int]bool{}
+	for _, value := range mappings {
+		i := strings.LastIndex(value, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid mapping %q, expected header:field", value)
+		}
+		name, field := strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+
+		column, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("no column %q to map", name)
+		}
+		if field != "" && !csvImportFields[field] {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if _, ok := mapping.fields[field]; ok && field != "" {
+			return nil, fmt.Errorf("field %q is mapped more than once", field)
+		}
+
+		mapped[column] = true
+		if field != "" {
+			mapping.fields[field] = column
+		}
+	}
+
+	for i, name := range header {
+		field := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := mapping.fields[field]; mapped[i] || ok || !csvImportFields[field] {
+			continue
+		}
+		mapping.fields[field] = i
+	}
+
+	return mapping, nil
+}
+
+// report describes the mapping for an import report.
+func (m *csvMapping) report(report *models.CSVImport) {
+	report.Columns = map[string]string{}
+	mapped := map[int]bool{}
+	for field, column := range m.fields {
+		report.Columns[m.headers[column]] = field
+		mapped[column] = true
+	}
+	for i, header := range m.headers {
+		if !mapped[i] {
+			report.Ignored = append(report.Ignored, header)
+		}
+	}
+}
+
+// value returns the trimmed cell of a record mapped to a field, and the
+// header of its column.
+func (m *csvMapping) value(record []string, field string) (string, string) {
+	column, ok := m.fields[field]
+	if !ok || column >= len(record) {
+		return "", ""
+	}
+	// Cells are trimmed before unescaping, which keeps escaped tabs
+	return unescapeCSVCell(strings.TrimSpace(record[column])), m.headers[column]
+}
+
+// parseCSVNotes reads note blocks from the records of a CSV document,
+// grouping notes by the block column in order of appearance. Rows with
+// invalid cells are reported and left out.
+func parseCSVNotes(records [][]string, mapping *csvMapping, vocabulary *noteVocabulary, report *models.CSVImport) []models.NoteBlock {
+	var noteBlocks []models.NoteBlock
+	blocks := map[string]int{}
+
+	for i, record := range records {
+		row := i + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		report.Rows++
+
+		var errs []models.CSVRowError
+		invalid := func(column, format string, args ...interface{}) {
+			errs = append(errs, models.CSVRowError{Row: row, Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+
+		note := models.Note{}
+		var column string
+		if note.Head, column = mapping.value(record, "head"); note.Head == "" {
+			invalid(column, "head is required")
+		}
+		note.Note, _ = mapping.value(record, "note")
+
+		if note.Priority, column = mapping.value(record, "priority"); note.Priority != "" && !vocabulary.priorities[note.Priority] {
+			invalid(column, "unknown priority %q", note.Priority)
+		}
+		if note.Status, column = mapping.value(record, "status"); note.Status != "" && !vocabulary.statuses[note.Status] {
+			invalid(column, "unknown status %q", note.Status)
+		}
+
+		tags, _ := mapping.value(record, "tags")
+		note.Tags = splitList(tags)
+
+		if value, column := mapping.value(record, "completed"); value != "" {
+			completed, err := parseCSVBool(value)
+			if err != nil {
+				invalid(column, "invalid completed %q, expected true or false", value)
+			}
+			note.Metadata.Completed = &completed
+		}
+
+		times := []struct {
+			field string
+			value *time.Time
+		}{
+			{"created", &note.Metadata.Created},
+			{"updated", &note.Metadata.Updated},
+		}
+		for _, param := range times {
+			value, column := mapping.value(record, param.field)
+			parsed, err := parseDateParam(value)
+			if err != nil {
+				invalid(column, "invalid %s %q, expected RFC 3339 or YYYY-MM-DD", param.field, value)
+			} else if parsed != nil {
+				*param.value = *parsed
+			}
+		}
+
+		if value, column := mapping.value(record, "due"); value != "" {
+			due, err := parseDateParam(value)
+			if err != nil {
+				invalid(column, "invalid due %q, expected RFC 3339 or YYYY-MM-DD", value)
+			}
+			note.Metadata.Due = due
+		}
+
+		if len(errs) > 0 {
+			report.Errors = append(report.Errors, errs...)
+			continue
+		}
+
+		head, _ := mapping.value(record, "block")
+		if head == "" {
+			head = csvDefaultBlock
+		}
+		block, ok := blocks[head]
+		if !ok {
+			block = len(noteBlocks)
+			blocks[head] = block
+			noteBlocks = append(noteBlocks, models.NoteBlock{Head: head})
+		}
+		noteBlocks[block].Notes = append(noteBlocks[block].Notes, note)
+	}
+
+	return noteBlocks
+}
+
+// parseCSVBool reads the ways spreadsheets spell booleans.
+func parseCSVBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "x", "done":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// ============================================================================
+// CSV Handlers
+// ============================================================================
+
+// HandleExportCSV exports the notes of the caller's workspaces, or of the
+// "workspaceId" workspace, as CSV with a row per note. Takes the filters and
+// sort of note listings; notes are in note block order by default.
+func (s *Server) HandleExportCSV(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseNoteFilter(query)
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	if workspaceID := query.Get("workspaceId"); workspaceID != "" {
+		if !s.authorizeWorkspace(w, token, workspaceID, models.RoleViewer) {
+			return
+		}
+		filter.WorkspaceIDs = []string{workspaceID}
+	} else if filter.WorkspaceIDs, err = s.visibleWorkspaces(ctx, token); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if len(filter.Sort) == 0 {
+		filter.Sort = []models.NoteSort{{Field: "noteBlock"}}
+	}
+	filter.Limit = csvPageSize
+	filter.Cursor = ""
+
+	// Read every page before writing, so that failures are still reported
+	var notes []models.ListedNote
+	for {
+		page, err := s.Repos.Note.List(ctx, filter)
+		if err != nil {
+			if strings.Contains(err.Error(), "invalid sort field") {
+				http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to export notes: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+		notes = append(notes, page.Notes...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=todo-export-%s.csv",
+		time.Now().Format("2006-01-02-15-04-05")))
+
+	writer := csv.NewWriter(w)
+	writer.Write(csvExportColumns)
+	for _, note := range notes {
+		completed := note.Metadata.Completed != nil && *note.Metadata.Completed
+		due := ""
+		if note.Metadata.Due != nil {
+			due = note.Metadata.Due.Format(time.RFC3339)
+		}
+		row := []string{
+			note.WorkspaceName,
+			note.NoteBlockHead,
+			formatID(note.ID),
+			note.Head,
+			note.Note.Note,
+			note.Priority,
+			strconv.FormatBool(completed),
+			note.Metadata.Created.Format(time.RFC3339),
+			note.Metadata.Updated.Format(time.RFC3339),
+			note.Status,
+			strings.Join(note.Tags, ","),
+			due,
+		}
+		for i := range row {
+			row[i] = escapeCSVCell(row[i])
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// HandleImportCSV adds the notes of a CSV document, sent as the request body,
+// to a workspace as new note blocks named by the block column. Columns are
+// mapped to note fields by name, or by "map=header:field" parameters; the
+// workspace and id columns of exports are ignored. Takes "delimiter" for
+// documents not separated by commas, and "dryRun=true" to only check the
+// mapping and the rows. Nothing is imported unless every row is valid.
+func (s *Server) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	query := r.URL.Query()
+	delimiter := ','
+	if value := query.Get("delimiter"); value != "" {
+		if utf8.RuneCountInString(value) != 1 {
+			http.Error(w, "Invalid delimiter, expected a single character", http.StatusBadRequest)
+			return
+		}
+		delimiter, _ = utf8.DecodeRuneInString(value)
+	}
+
+	dryRun := false
+	if value := query.Get("dryRun"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid dryRun, expected true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	document, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+
+	// Spreadsheets often save with a byte order mark
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(document, []byte("\ufeff"))))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			http.Error(w, fmt.Sprintf("Invalid CSV on line %d: %v", parseError.Line, parseError.Err), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Invalid CSV", http.StatusBadRequest)
+		}
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, "Document has no header", http.StatusUnprocessableEntity)
+		return
+	}
+
+	mapping, err := newCSVMapping(records[0], query["map"])
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	vocabulary, err := s.noteVocabulary(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	report := models.CSVImport{}
+	mapping.report(&report)
+	status := http.StatusOK
+	if _, ok := mapping.fields["head"]; !ok {
+		report.Errors = append(report.Errors, models.CSVRowError{Row: 1, Message: "no column is mapped to head"})
+	} else {
+		noteBlocks := parseCSVNotes(records[1:], mapping, vocabulary, &report)
+		if report.Rows == 0 {
+			report.Errors = append(report.Errors, models.CSVRowError{Row: 1, Message: "document has no rows"})
+		}
+		if len(report.Errors) == 0 && !dryRun {
+			if !s.importNoteBlocks(w, r, id, noteBlocks) {
+				return
+			}
+			report.NoteBlocks = noteBlocks
+			status = http.StatusCreated
+		}
+	}
+	if len(report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// dependencyRequest links a note to exactly one other note, either as its
+// blocker or as a note it blocks.
+type dependencyRequest struct {
+	BlockedBy int64 `json:"blockedBy"`
+	Blocks    int64 `json:"blocks"`
+}
+
+// dependencyID is the entity ID of a dependency in the audit log.
+func dependencyID(noteID, dependsOnID int64) string {
+	return fmt.Sprintf("%d:%d", noteID, dependsOnID)
+}
+
+// ============================================================================
+// Note Dependency Handlers
+// ============================================================================
+
+// HandleGetDependencies returns the notes a note is blocked by and the notes
+// it blocks.
+func (s *Server) HandleGetDependencies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	dependencies := models.NoteDependencies{NoteID: id}
+
+	dependencies.BlockedBy, err = s.Repos.Dependency.GetBlockers(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get dependencies: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	dependencies.Blocks, err = s.Repos.Dependency.GetBlocked(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get dependencies: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dependencies)
+}
+
+// HandleAddDependency links a note to another note of the same workspace,
+// in any note block. Links that would make notes wait on each other are
+// rejected.
+func (s *Server) HandleAddDependency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var request dependencyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if (request.BlockedBy == 0) == (request.Blocks == 0) {
+		http.Error(w, "Exactly one of blockedBy and blocks is required", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	noteID, dependsOnID, otherID := id, request.BlockedBy, request.BlockedBy
+	if request.Blocks != 0 {
+		noteID, dependsOnID, otherID = request.Blocks, id, request.Blocks
+	}
+
+	ctx := context.Background()
+	otherWorkspaceID, err := s.Repos.Note.GetWorkspaceID(ctx, otherID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, fmt.Sprintf("Note %d not found", otherID), http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	if otherWorkspaceID != workspaceID {
+		http.Error(w, "Dependencies must stay within a workspace", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := s.Repos.Dependency.Add(ctx, noteID, dependsOnID); err != nil {
+		if strings.Contains(err.Error(), "dependency cycle") || strings.Contains(err.Error(), "already exists") {
+			http.Error(w, capitalize(err.Error()), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to add dependency: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityDependency, EntityID: dependencyID(noteID, dependsOnID), Action: models.ActionCreate,
+	}, nil, request)
+
+	note, err := s.Repos.Note.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// HandleRemoveDependency unlinks a note from another one, whichever of the
+// two is the blocker.
+func (s *Server) HandleRemoveDependency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	otherID, err := strconv.ParseInt(vars["otherId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	noteID, dependsOnID := id, otherID
+	err = s.Repos.Dependency.Remove(ctx, noteID, dependsOnID)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		noteID, dependsOnID = otherID, id
+		err = s.Repos.Dependency.Remove(ctx, noteID, dependsOnID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Dependency not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to remove dependency: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityDependency, EntityID: dependencyID(noteID, dependsOnID), Action: models.ActionDelete,
+	}, dependencyRequest{BlockedBy: dependsOnID}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
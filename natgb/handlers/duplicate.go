@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// ============================================================================
+// Duplicate Handlers
+// ============================================================================
+
+// HandleDuplicateWorkspace copies a workspace with all its note blocks and
+// notes. The optional body sets the new ID and name and whether completion
+// is reset; the caller owns the copy.
+func (s *Server) HandleDuplicateWorkspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var request struct {
+		ID              string `json:"id"`
+		Name            string `json:"name"`
+		ResetCompletion bool   `json:"resetCompletion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.Duplicate(ctx, id, request.ID, request.Name, requestToken(r).UserID, request.ResetCompletion)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Workspace ID already exists", http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to duplicate workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspace.ID, EntityType: models.EntityWorkspace, EntityID: workspace.ID, Action: models.ActionCreate,
+	}, nil, workspace)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// HandleDuplicateNoteBlock copies a note block with its notes into the same
+// workspace or, with "workspaceId", into another one the caller can edit.
+func (s *Server) HandleDuplicateNoteBlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note block ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		WorkspaceID     string `json:"workspaceId"`
+		Head            string `json:"head"`
+		ResetCompletion bool   `json:"resetCompletion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	sourceWorkspaceID, ok := s.authorize(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	workspaceID := request.WorkspaceID
+	if workspaceID == "" {
+		workspaceID = sourceWorkspaceID
+	}
+	if !s.authorizeWorkspace(w, requestToken(r), workspaceID, models.RoleEditor) {
+		return
+	}
+
+	ctx := context.Background()
+	copied, err := s.Repos.NoteBlock.Duplicate(ctx, id, workspaceID, request.Head, request.ResetCompletion)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Note block not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to duplicate note block: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	noteBlock, err := s.noteBlockWithNotes(ctx, copied.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note block: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(noteBlock.ID), Action: models.ActionCreate,
+	}, nil, noteBlock)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(noteBlock)
+}
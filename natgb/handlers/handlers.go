@@ -12,10 +12,13 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/tanjeetsarkar/nat/models"
 	"github.com/tanjeetsarkar/nat/repositories"
+	"github.com/tanjeetsarkar/nat/services"
 )
 
 type Server struct {
-	Repos *repositories.Repositories
+	Repos    *repositories.Repositories
+	Webhooks *services.WebhookDispatcher // Optional; events are not delivered when nil
+	Blobs    services.BlobStore          // Optional; attachments are disabled when nil
 }
 
 // ============================================================================
@@ -23,30 +26,63 @@ type Server struct {
 // ============================================================================
 
 func (s *Server) HandleGetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
 	ctx := context.Background()
-	workspaces, err := s.Repos.Workspace.GetAll(ctx)
+	workspaces, err := s.Repos.Workspace.GetByUserID(ctx, token.UserID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Workspace-limited tokens only see their own workspace
+	if token.WorkspaceID != nil {
+		scoped := []models.Workspace{}
+		for _, workspace := range workspaces {
+			if workspace.ID == *token.WorkspaceID {
+				scoped = append(scoped, workspace)
+			}
+		}
+		workspaces = scoped
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(workspaces)
 }
 
 func (s *Server) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	if templateID := r.URL.Query().Get("template"); templateID != "" {
+		s.createWorkspaceFromTemplate(w, r, token, templateID)
+		return
+	}
+
 	var workspace models.Workspace
 	if err := json.NewDecoder(r.Body).Decode(&workspace); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	// The creator owns the new workspace
 	ctx := context.Background()
-	if err := s.Repos.Workspace.Create(ctx, &workspace); err != nil {
+	if err := s.Repos.Workspace.Create(ctx, &workspace, token.UserID); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create workspace: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspace.ID, EntityType: models.EntityWorkspace, EntityID: workspace.ID, Action: models.ActionCreate,
+	}, nil, workspace)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(workspace)
@@ -56,6 +92,10 @@ func (s *Server) HandleGetWorkspace(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	workspace, err := s.Repos.Workspace.GetByID(ctx, id)
 	if err != nil {
@@ -75,6 +115,10 @@ func (s *Server) HandleGetWorkspaceWithHierarchy(w http.ResponseWriter, r *http.
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
 	if err != nil {
@@ -102,7 +146,21 @@ func (s *Server) HandleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
 
 	workspace.ID = id // Ensure ID matches the URL parameter
 
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.Workspace.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	if err := s.Repos.Workspace.Update(ctx, &workspace); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Workspace not found", http.StatusNotFound)
@@ -112,6 +170,10 @@ func (s *Server) HandleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: id, EntityType: models.EntityWorkspace, EntityID: id, Action: models.ActionUpdate,
+	}, before, workspace)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(workspace)
 }
@@ -120,7 +182,34 @@ func (s *Server) HandleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The owners at deletion keep access to the trail
+	members, err := s.Repos.Member.GetByWorkspaceID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get members: %v", err), http.StatusInternalServerError)
+		return
+	}
+	owners := []string{}
+	for _, member := range members {
+		if member.Role == models.RoleOwner {
+			owners = append(owners, member.UserID)
+		}
+	}
+
 	if err := s.Repos.Workspace.Delete(ctx, id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Workspace not found", http.StatusNotFound)
@@ -130,6 +219,12 @@ func (s *Server) HandleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.purgeBlobs(ctx)
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: id, EntityType: models.EntityWorkspace, EntityID: id, Action: models.ActionDelete, Owners: owners,
+	}, before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -141,6 +236,10 @@ func (s *Server) HandleGetNoteBlocks(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	workspaceID := vars["workspaceId"]
 
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	noteBlocks, err := s.Repos.NoteBlock.GetByWorkspaceID(ctx, workspaceID)
 	if err != nil {
@@ -162,12 +261,20 @@ func (s *Server) HandleCreateNoteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	if err := s.Repos.NoteBlock.Create(ctx, &noteBlock, workspaceID); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create note block: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(noteBlock.ID), Action: models.ActionCreate,
+	}, nil, noteBlock)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(noteBlock)
@@ -183,6 +290,10 @@ func (s *Server) HandleGetNoteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	noteBlock, err := s.Repos.NoteBlock.GetByID(ctx, id)
 	if err != nil {
@@ -216,7 +327,18 @@ func (s *Server) HandleUpdateNoteBlock(w http.ResponseWriter, r *http.Request) {
 
 	noteBlock.ID = id // Ensure ID matches the URL parameter
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.NoteBlock.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note block: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	if err := s.Repos.NoteBlock.Update(ctx, &noteBlock); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Note block not found", http.StatusNotFound)
@@ -226,6 +348,10 @@ func (s *Server) HandleUpdateNoteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(id), Action: models.ActionUpdate,
+	}, before, noteBlock)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(noteBlock)
 }
@@ -240,7 +366,18 @@ func (s *Server) HandleDeleteNoteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.noteBlockWithNotes(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note block: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	if err := s.Repos.NoteBlock.Delete(ctx, id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Note block not found", http.StatusNotFound)
@@ -250,9 +387,17 @@ func (s *Server) HandleDeleteNoteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.purgeBlobs(ctx)
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(id), Action: models.ActionDelete,
+	}, before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// HandleGetNotes lists the notes of a note block, filtered, sorted and
+// paginated as described by parseNoteFilter.
 func (s *Server) HandleGetNotes(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -263,15 +408,20 @@ func (s *Server) HandleGetNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	notes, err := s.Repos.Note.GetByNoteBlockID(ctx, id)
+	filter, err := parseNoteFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get notes: %v", err), http.StatusInternalServerError)
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
+	workspaceID, ok := s.authorize(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	filter.WorkspaceIDs = []string{workspaceID}
+	filter.NoteBlockID = id
+	s.listNotes(w, filter)
 }
 
 // ============================================================================
@@ -294,12 +444,29 @@ func (s *Server) HandleCreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Notes created without a priority get the default of their workspace
 	ctx := context.Background()
+	if note.Priority != "" && !s.checkPriority(ctx, w, workspaceID, note.Priority) {
+		return
+	}
+	if !s.checkStatus(ctx, w, workspaceID, note.Status) {
+		return
+	}
+
 	if err := s.Repos.Note.Create(ctx, &note, noteBlockID); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create note: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(note.ID), Action: models.ActionCreate,
+	}, nil, note)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(note)
@@ -315,6 +482,10 @@ func (s *Server) HandleGetNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
 	ctx := context.Background()
 	note, err := s.Repos.Note.GetByID(ctx, id)
 	if err != nil {
@@ -348,7 +519,26 @@ func (s *Server) HandleUpdateNote(w http.ResponseWriter, r *http.Request) {
 
 	note.ID = id // Ensure ID matches the URL parameter
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.Note.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Notes keep priorities that predate validation
+	if note.Priority != before.Priority && !s.checkPriority(ctx, w, workspaceID, note.Priority) {
+		return
+	}
+	if !s.checkStatus(ctx, w, workspaceID, note.Status) {
+		return
+	}
+
 	if err := s.Repos.Note.Update(ctx, &note); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Note not found", http.StatusNotFound)
@@ -358,6 +548,10 @@ func (s *Server) HandleUpdateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(id), Action: models.ActionUpdate,
+	}, before, note)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(note)
 }
@@ -372,7 +566,18 @@ func (s *Server) HandleDeleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.Note.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	if err := s.Repos.Note.Delete(ctx, id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Note not found", http.StatusNotFound)
@@ -382,6 +587,12 @@ func (s *Server) HandleDeleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.purgeBlobs(ctx)
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(id), Action: models.ActionDelete,
+	}, before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -395,7 +606,18 @@ func (s *Server) HandleToggleNoteCompleted(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
 	ctx := context.Background()
+	before, err := s.Repos.Note.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	if err := s.Repos.Note.ToggleCompleted(ctx, id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Note not found", http.StatusNotFound)
@@ -412,85 +634,27 @@ func (s *Server) HandleToggleNoteCompleted(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityNote, EntityID: formatID(id), Action: models.ActionToggle,
+	}, before, note)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(note)
 }
 
 // ============================================================================
-// Filtering Handlers
+// Import/Export Handlers
 // ============================================================================
 
-func (s *Server) HandleGetNotesByPriority(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	noteBlockIDStr := vars["noteBlockId"]
-	priority := vars["priority"]
-
-	noteBlockID, err := strconv.ParseInt(noteBlockIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid note block ID", http.StatusBadRequest)
-		return
-	}
-
-	ctx := context.Background()
-	notes, err := s.Repos.Note.GetByPriority(ctx, noteBlockID, priority)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get notes by priority: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
-}
-
-func (s *Server) HandleGetCompletedNotes(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	noteBlockIDStr := vars["noteBlockId"]
-
-	noteBlockID, err := strconv.ParseInt(noteBlockIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid note block ID", http.StatusBadRequest)
-		return
-	}
-
-	ctx := context.Background()
-	notes, err := s.Repos.Note.GetCompleted(ctx, noteBlockID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get completed notes: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
-}
-
-func (s *Server) HandleGetPendingNotes(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	noteBlockIDStr := vars["noteBlockId"]
-
-	noteBlockID, err := strconv.ParseInt(noteBlockIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid note block ID", http.StatusBadRequest)
+func (s *Server) HandleExportData(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
 		return
 	}
 
 	ctx := context.Background()
-	notes, err := s.Repos.Note.GetPending(ctx, noteBlockID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get pending notes: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
-}
-
-// ============================================================================
-// Import/Export Handlers
-// ============================================================================
-
-func (s *Server) HandleExportData(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	exportData, err := s.Repos.Workspace.ExportAll(ctx)
+	exportData, err := s.Repos.Workspace.ExportForUser(ctx, token.UserID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to export data: %v", err), http.StatusInternalServerError)
 		return
@@ -503,6 +667,12 @@ func (s *Server) HandleExportData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) HandleImportData(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
 	var importData models.ExportData
 	if err := json.NewDecoder(r.Body).Decode(&importData); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -510,15 +680,27 @@ func (s *Server) HandleImportData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := context.Background()
-	if err := s.Repos.Workspace.ImportWorkspaces(ctx, importData.Workspaces); err != nil {
+	if err := s.Repos.Workspace.ImportWorkspaces(ctx, importData.Workspaces, token.UserID); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to import data: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	s.finishImport(w, r, importData.Workspaces)
+}
+
+// finishImport records the workspaces imported, which the importer owns, and
+// reports how many there were.
+func (s *Server) finishImport(w http.ResponseWriter, r *http.Request, workspaces []models.Workspace) {
+	for _, workspace := range workspaces {
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: workspace.ID, EntityType: models.EntityWorkspace, EntityID: workspace.ID, Action: models.ActionCreate,
+		}, nil, workspace)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":             "Data imported successfully",
-		"imported_workspaces": len(importData.Workspaces),
+		"imported_workspaces": len(workspaces),
 	})
 }
 
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// historyConflict reports that an operation can no longer be applied because
+// the entity changed outside the undo history.
+type historyConflict string
+
+func (c historyConflict) Error() string {
+	return string(c)
+}
+
+// recordOperation adds a mutation to the undo history of its workspace.
+// Content changes are undoable: note blocks, notes and workspace settings.
+// Memberships, share links and webhooks are not.
+func (s *Server) recordOperation(entry models.AuditEntry, before, after interface{}) {
+	op := models.Operation{
+		WorkspaceID: entry.WorkspaceID,
+		EntityType:  entry.EntityType,
+		EntityID:    entry.EntityID,
+		Action:      entry.Action,
+		Actor:       entry.Actor,
+		Before:      entry.Before,
+		After:       entry.After,
+	}
+
+	switch entry.EntityType {
+	case models.EntityWorkspace:
+		if entry.Action != models.ActionUpdate {
+			return
+		}
+	case models.EntityNoteBlock:
+	case models.EntityNote:
+		// Notes are recreated in their block, which snapshots do not carry
+		note := noteSnapshot(before)
+		if note == nil || note.NoteBlockID == 0 {
+			note = noteSnapshot(after)
+		}
+		if note != nil && note.NoteBlockID != 0 {
+			op.ParentID = formatID(note.NoteBlockID)
+		}
+	default:
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Operation.Record(ctx, &op); err != nil {
+		log.Printf("history: failed to record %s of %s %s: %v", op.Action, op.EntityType, op.EntityID, err)
+	}
+}
+
+// applySnapshot moves an entity from the current snapshot to the target one:
+// a missing target deletes the entity, a missing current state recreates it
+// with its original ID, and otherwise the target state is restored. It
+// returns the audit entry and live snapshots of the change.
+func (s *Server) applySnapshot(ctx context.Context, op *models.Operation, current, target json.RawMessage) (models.AuditEntry, interface{}, interface{}, error) {
+	entry := models.AuditEntry{WorkspaceID: op.WorkspaceID, EntityType: op.EntityType, EntityID: op.EntityID}
+	switch {
+	case target == nil:
+		entry.Action = models.ActionDelete
+	case current == nil:
+		entry.Action = models.ActionCreate
+	default:
+		entry.Action = models.ActionUpdate
+	}
+
+	switch op.EntityType {
+	case models.EntityWorkspace:
+		var workspace models.Workspace
+		if err := json.Unmarshal(target, &workspace); err != nil {
+			return entry, nil, nil, fmt.Errorf("failed to decode workspace snapshot: %w", err)
+		}
+
+		before, err := s.Repos.Workspace.GetByID(ctx, op.WorkspaceID)
+		if err != nil {
+			return entry, nil, nil, err
+		}
+		workspace.ID = op.WorkspaceID
+		if err := s.Repos.Workspace.Update(ctx, &workspace); err != nil {
+			return entry, nil, nil, err
+		}
+		return entry, before, workspace, nil
+
+	case models.EntityNoteBlock:
+		id, err := strconv.ParseInt(op.EntityID, 10, 64)
+		if err != nil {
+			return entry, nil, nil, fmt.Errorf("invalid note block ID %q", op.EntityID)
+		}
+
+		if entry.Action == models.ActionDelete {
+			// Cascades to the notes, which the snapshot keeps for redo
+			before, err := s.noteBlockWithNotes(ctx, id)
+			if err != nil {
+				return entry, nil, nil, err
+			}
+			if err := s.Repos.NoteBlock.Delete(ctx, id); err != nil {
+				return entry, nil, nil, err
+			}
+			return entry, before, nil, nil
+		}
+
+		var noteBlock models.NoteBlock
+		if err := json.Unmarshal(target, &noteBlock); err != nil {
+			return entry, nil, nil, fmt.Errorf("failed to decode note block snapshot: %w", err)
+		}
+		noteBlock.ID = id
+
+		if entry.Action == models.ActionUpdate {
+			before, err := s.Repos.NoteBlock.GetByID(ctx, id)
+			if err != nil {
+				return entry, nil, nil, err
+			}
+			if err := s.Repos.NoteBlock.Update(ctx, &noteBlock); err != nil {
+				return entry, nil, nil, err
+			}
+			return entry, before, noteBlock, nil
+		}
+
+		if _, err := s.Repos.NoteBlock.GetByID(ctx, id); err == nil {
+			return entry, nil, nil, historyConflict("note block ID is already in use")
+		}
+		for _, note := range noteBlock.Notes {
+			if err := restorableNote(note); err != nil {
+				return entry, nil, nil, err
+			}
+		}
+		// Restore the notes removed together with the block
+		if err := s.Repos.Workspace.RestoreNoteBlock(ctx, op.WorkspaceID, &noteBlock); err != nil {
+			return entry, nil, nil, err
+		}
+		return entry, nil, noteBlock, nil
+
+	case models.EntityNote:
+		id, err := strconv.ParseInt(op.EntityID, 10, 64)
+		if err != nil {
+			return entry, nil, nil, fmt.Errorf("invalid note ID %q", op.EntityID)
+		}
+
+		if entry.Action == models.ActionDelete {
+			before, err := s.Repos.Note.GetByID(ctx, id)
+			if err != nil {
+				return entry, nil, nil, err
+			}
+			if err := s.Repos.Note.Delete(ctx, id); err != nil {
+				return entry, nil, nil, err
+			}
+			return entry, before, nil, nil
+		}
+
+		var note models.Note
+		if err := json.Unmarshal(target, &note); err != nil {
+			return entry, nil, nil, fmt.Errorf("failed to decode note snapshot: %w", err)
+		}
+		note.ID = id
+
+		if entry.Action == models.ActionUpdate {
+			before, err := s.Repos.Note.GetByID(ctx, id)
+			if err != nil {
+				return entry, nil, nil, err
+			}
+			if err := s.Repos.Note.Update(ctx, &note); err != nil {
+				return entry, nil, nil, err
+			}
+			note.NoteBlockID = before.NoteBlockID
+			return entry, before, note, nil
+		}
+
+		noteBlockID, err := strconv.ParseInt(op.ParentID, 10, 64)
+		if err != nil {
+			return entry, nil, nil, historyConflict("note block of the note is unknown")
+		}
+		if _, err := s.Repos.NoteBlock.GetByID(ctx, noteBlockID); err != nil {
+			return entry, nil, nil, err
+		}
+		if _, err := s.Repos.Note.GetByID(ctx, id); err == nil {
+			return entry, nil, nil, historyConflict("note ID is already in use")
+		}
+		if err := restorableNote(note); err != nil {
+			return entry, nil, nil, err
+		}
+		if err := s.Repos.Note.Restore(ctx, &note, noteBlockID); err != nil {
+			return entry, nil, nil, err
+		}
+		return entry, nil, note, nil
+	}
+
+	return entry, nil, nil, fmt.Errorf("unsupported entity type %q", op.EntityType)
+}
+
+// restorableNote checks that a deleted note can be recreated from its
+// snapshot. Its dependencies are kept there, but its comments and
+// attachments were deleted along with it, and the content of attachments
+// purged, so such notes cannot come back whole.
+func restorableNote(note models.Note) error {
+	if note.CommentCount > 0 || len(note.Attachments) > 0 {
+		return historyConflict(fmt.Sprintf("note %d had comments or attachments, which were deleted with it", note.ID))
+	}
+	return nil
+}
+
+// ============================================================================
+// Undo/Redo Handlers
+// ============================================================================
+
+// HandleGetOperations returns the undo history of a workspace, newest first.
+func (s *Server) HandleGetOperations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	limit, err := parseIntParam(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	operations, err := s.Repos.Operation.GetByWorkspaceID(ctx, workspaceID, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get operations: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(operations)
+}
+
+// HandleUndo reverts the most recent operation of a workspace.
+func (s *Server) HandleUndo(w http.ResponseWriter, r *http.Request) {
+	s.stepHistory(w, r, true)
+}
+
+// HandleRedo reapplies the operation that was undone last.
+func (s *Server) HandleRedo(w http.ResponseWriter, r *http.Request) {
+	s.stepHistory(w, r, false)
+}
+
+// stepHistory undoes or redoes one operation and responds with it. An
+// operation that conflicts with changes made outside the history is dropped,
+// so that the next step can proceed.
+func (s *Server) stepHistory(w http.ResponseWriter, r *http.Request, undo bool) {
+	verb := "redo"
+	if undo {
+		verb = "undo"
+	}
+
+	workspaceID, ok := s.authorize(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var op *models.Operation
+	var err error
+	if undo {
+		op, err = s.Repos.Operation.NextUndo(ctx, workspaceID)
+	} else {
+		op, err = s.Repos.Operation.NextRedo(ctx, workspaceID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "nothing to") {
+			http.Error(w, capitalize(err.Error()), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get operation: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Undo moves from the after snapshot back to the before one, redo forward
+	current, target := op.Before, op.After
+	if undo {
+		current, target = op.After, op.Before
+	}
+
+	entry, before, after, err := s.applySnapshot(ctx, op, current, target)
+	if err != nil {
+		var conflict historyConflict
+		if errors.As(err, &conflict) || strings.Contains(err.Error(), "not found") {
+			if err := s.Repos.Operation.Delete(ctx, op.ID); err != nil {
+				log.Printf("history: failed to drop operation %d: %v", op.ID, err)
+			}
+			http.Error(w, fmt.Sprintf("Cannot %s %s of %s %s: %v", verb, op.Action, op.EntityType, op.EntityID, err), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to %s operation: %v", verb, err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.Repos.Operation.SetUndone(ctx, op.ID, undo); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to %s operation: %v", verb, err), http.StatusInternalServerError)
+		return
+	}
+	op.Undone = undo
+
+	s.logMutation(r, entry, before, after)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
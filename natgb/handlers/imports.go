@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// maxDocumentSize is the largest document accepted by the text importers.
+const maxDocumentSize = 10 << 20
+
+// readDocument reads an imported document from the request body.
+func readDocument(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	document, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentSize))
+	if err != nil {
+		http.Error(w, "Document is too large or unreadable", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return document, true
+}
+
+// noteVocabulary holds the priorities and statuses notes of a workspace may
+// use, to check imported notes against.
+type noteVocabulary struct {
+	priorities map[string]bool
+	statuses   map[string]bool
+	ranked     []string // Priority names, most urgent first
+}
+
+func (s *Server) noteVocabulary(ctx context.Context, workspaceID string) (*noteVocabulary, error) {
+	priorities, err := s.Repos.Priority.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.Repos.Status.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	vocabulary := &noteVocabulary{priorities: map[string]bool{}, statuses: map[string]bool{}}
+	for _, priority := range priorities {
+		vocabulary.priorities[priority.Name] = true
+		vocabulary.ranked = append(vocabulary.ranked, priority.Name)
+	}
+	for _, status := range statuses {
+		vocabulary.statuses[status.Key] = true
+	}
+	return vocabulary, nil
+}
+
+// check returns why a note cannot be imported, if it cannot.
+func (v *noteVocabulary) check(note models.Note) error {
+	if note.Priority != "" && !v.priorities[note.Priority] {
+		return fmt.Errorf("unknown priority %q", note.Priority)
+	}
+	if note.Status != "" && !v.statuses[note.Status] {
+		return fmt.Errorf("unknown status %q", note.Status)
+	}
+	return nil
+}
+
+// importNoteBlocks adds imported note blocks to a workspace. Each block is
+// audited and undone on its own.
+func (s *Server) importNoteBlocks(w http.ResponseWriter, r *http.Request, workspaceID string, noteBlocks []models.NoteBlock) bool {
+	ctx := context.Background()
+	if err := s.Repos.Workspace.AddNoteBlocks(ctx, workspaceID, noteBlocks); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to import note blocks: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	for _, noteBlock := range noteBlocks {
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: workspaceID, EntityType: models.EntityNoteBlock, EntityID: formatID(noteBlock.ID), Action: models.ActionCreate,
+		}, nil, noteBlock)
+	}
+
+	return true
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// Markdown documents have a heading per note block and a GitHub task-list
+// item per note. The item text is the head of the note, followed by inline
+// markers in code spans:
+//
+//	## Backlog
+//	- [ ] Write the release notes `priority:high` `status:review` `#docs` `created:2024-05-01` `due:2024-05-10`
+//	  Content of the note, indented.
+//	- [x] Tag the release `completed:2024-05-03`
+const markdownDate = "2006-01-02"
+
+// markdownDefaultBlock holds the notes that come before any heading.
+const markdownDefaultBlock = "Notes"
+
+var (
+	markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownItem    = regexp.MustCompile(`^[-*+]\s+(?:\[([ xX])\]\s+)?(.*)$`)
+	markdownMarker  = regexp.MustCompile("\\s*`([^`]*)`\\s*$")
+)
+
+// renderMarkdown writes a workspace as a Markdown document.
+func renderMarkdown(workspace *models.Workspace) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", markdownLine(workspace.Name))
+
+	for _, noteBlock := range workspace.Data.NoteBlocks {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownLine(noteBlock.Head))
+
+		for _, note := range noteBlock.Notes {
+			check := " "
+			if note.Metadata.Completed != nil && *note.Metadata.Completed {
+				check = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] %s", check, markdownLine(note.Head))
+
+			if note.Priority != "" {
+				fmt.Fprintf(&b, " `priority:%s`", note.Priority)
+			}
+			if note.Status != "" {
+				fmt.Fprintf(&b, " `status:%s`", note.Status)
+			}
+			for _, tag := range note.Tags {
+				fmt.Fprintf(&b, " `#%s`", tag)
+			}
+			if !note.Metadata.Created.IsZero() {
+				fmt.Fprintf(&b, " `created:%s`", note.Metadata.Created.Format(markdownDate))
+			}
+			if note.Metadata.Due != nil {
+				fmt.Fprintf(&b, " `due:%s`", note.Metadata.Due.Format(markdownDate))
+			}
+			if note.Metadata.CompletedAt != nil {
+				fmt.Fprintf(&b, " `completed:%s`", note.Metadata.CompletedAt.Format(markdownDate))
+			}
+			b.WriteString("\n")
+
+			if content := strings.TrimRight(note.Note, "\n"); content != "" {
+				for _, line := range strings.Split(content, "\n") {
+					if line == "" {
+						b.WriteString("\n")
+					} else {
+						fmt.Fprintf(&b, "  %s\n", line)
+					}
+				}
+			}
+		}
+	}
+
+	return b.Bytes()
+}
+
+// markdownLine keeps text that must stay on one line from breaking it.
+func markdownLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// parseMarkdown reads note blocks and notes from a Markdown document as
+// rendered by renderMarkdown. The first-level heading is the workspace name
+// and is ignored. Lines that are neither headings, items nor indented
+// content of an item are skipped. Errors name the line they were found on.
+func parseMarkdown(document []byte, vocabulary *noteVocabulary) ([]models.NoteBlock, error) {
+	var noteBlocks []models.NoteBlock
+	var note *models.Note
+	var blank int // Blank lines held until content of the note follows
+	var errs []error
+
+	// Notes are only appended to their block once complete, so that the
+	// pointer to the current one stays valid
+	finishNote := func() {
+		if note == nil {
+			return
+		}
+		note.Note = strings.TrimRight(note.Note, "\n")
+		block := &noteBlocks[len(noteBlocks)-1]
+		block.Notes = append(block.Notes, *note)
+		note = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(document))
+	scanner.Buffer(nil, maxDocumentSize)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if line == "" {
+			if note != nil {
+				blank++
+			}
+			continue
+		}
+
+		if note != nil && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) {
+			if note.Note != "" {
+				note.Note += strings.Repeat("\n", blank)
+			}
+			blank = 0
+			content := strings.TrimPrefix(line, "\t")
+			if content == line {
+				content = strings.TrimPrefix(line, "  ")
+			}
+			note.Note += content + "\n"
+			continue
+		}
+
+		finishNote()
+		blank = 0
+
+		if match := markdownHeading.FindStringSubmatch(line); match != nil {
+			if len(match[1]) > 1 {
+				noteBlocks = append(noteBlocks, models.NoteBlock{Head: match[2]})
+			}
+			continue
+		}
+
+		if match := markdownItem.FindStringSubmatch(line); match != nil {
+			parsed, err := parseMarkdownItem(match[1], match[2])
+			if err == nil {
+				err = vocabulary.check(*parsed)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Line %d: %w", number, err))
+				continue
+			}
+			if len(noteBlocks) == 0 {
+				noteBlocks = append(noteBlocks, models.NoteBlock{Head: markdownDefaultBlock})
+			}
+			note = parsed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finishNote()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return noteBlocks, nil
+}
+
+// parseMarkdownItem reads a note from a task-list item. Markers are taken
+// from the end of the text; code spans that are not markers stay in the head.
+func parseMarkdownItem(check, text string) (*models.Note, error) {
+	note := &models.Note{}
+	completed := check == "x" || check == "X"
+	note.Metadata.Completed = &completed
+
+	for {
+		match := markdownMarker.FindStringSubmatchIndex(text)
+		if match == nil {
+			break
+		}
+		marker := text[match[2]:match[3]]
+
+		if tag, ok := strings.CutPrefix(marker, "#"); ok && tag != "" {
+			note.Tags = append([]string{tag}, note.Tags...)
+		} else if key, value, ok := strings.Cut(marker, ":"); ok {
+			switch key {
+			case "priority":
+				note.Priority = value
+			case "status":
+				note.Status = value
+			case "created", "completed", "due":
+				day, err := time.Parse(markdownDate, value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s date %q", key, value)
+				}
+				switch key {
+				case "created":
+					note.Metadata.Created = day
+				case "completed":
+					note.Metadata.CompletedAt = &day
+				default:
+					note.Metadata.Due = &day
+				}
+			default:
+				return note, finishMarkdownItem(note, text)
+			}
+		} else {
+			break
+		}
+		text = text[:match[0]]
+	}
+
+	return note, finishMarkdownItem(note, text)
+}
+
+func finishMarkdownItem(note *models.Note, head string) error {
+	note.Head = strings.TrimSpace(head)
+	if note.Head == "" {
+		return fmt.Errorf("note head is required")
+	}
+	return nil
+}
+
+// ============================================================================
+// Markdown Handlers
+// ============================================================================
+
+// HandleExportMarkdown renders a workspace as a Markdown document, a heading
+// per note block and a task-list item per note.
+func (s *Server) HandleExportMarkdown(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.md", workspace.ID))
+	w.Write(renderMarkdown(workspace))
+}
+
+// HandleImportMarkdown adds the note blocks and notes of a Markdown document,
+// sent as the request body, to a workspace. Nothing is imported unless every
+// note is valid; the errors are listed a line each.
+func (s *Server) HandleImportMarkdown(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	document, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	vocabulary, err := s.noteVocabulary(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	noteBlocks, err := parseMarkdown(document, vocabulary)
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+	if len(noteBlocks) == 0 {
+		http.Error(w, "Document has no note blocks", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !s.importNoteBlocks(w, r, id, noteBlocks) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(noteBlocks)
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// roleRanks orders roles so that a higher rank includes every permission of
+// the lower ones.
+var roleRanks = map[string]int{
+	models.RoleViewer:    1,
+	models.RoleCommenter: 2,
+	models.RoleEditor:    3,
+	models.RoleOwner:     4,
+}
+
+func validRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// ============================================================================
+// Authorization
+// ============================================================================
+
+// authorize checks that the caller holds at least the given role on the
+// workspace the request operates on and returns that workspace's ID. It writes
+// an error response and returns false when the request must not proceed.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, role string) (string, bool) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return "", false
+	}
+
+	ctx := context.Background()
+	workspaceID, ok, err := s.requestWorkspaceID(ctx, r)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, capitalize(err.Error()), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to resolve workspace: %v", err), http.StatusInternalServerError)
+		}
+		return "", false
+	}
+	if !ok {
+		http.Error(w, "Route is not scoped to a workspace", http.StatusInternalServerError)
+		return "", false
+	}
+
+	if !s.authorizeWorkspace(w, token, workspaceID, role) {
+		return "", false
+	}
+
+	return workspaceID, true
+}
+
+// authorizeWorkspace checks that the token's user holds at least the given
+// role on a workspace, for requests that touch a workspace other than the one
+// in their route.
+func (s *Server) authorizeWorkspace(w http.ResponseWriter, token *models.APIToken, workspaceID, role string) bool {
+	if token.WorkspaceID != nil && *token.WorkspaceID != workspaceID {
+		http.Error(w, "Token is limited to a single workspace", http.StatusForbidden)
+		return false
+	}
+
+	ctx := context.Background()
+	member, err := s.workspaceMember(ctx, workspaceID, token.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "workspace not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get membership: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if roleRanks[member.Role] < roleRanks[role] {
+		http.Error(w, fmt.Sprintf("Requires %s role", role), http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// workspaceMember returns the caller's membership of a workspace. Workspaces
+// created before memberships existed have no members at all and are reported
+// as not found until they are given an owner with -legacy-owner.
+func (s *Server) workspaceMember(ctx context.Context, workspaceID, userID string) (*models.WorkspaceMember, error) {
+	member, err := s.Repos.Member.Get(ctx, workspaceID, userID)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		return member, err
+	}
+
+	members, err := s.Repos.Member.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("workspace not found")
+	}
+	return nil, fmt.Errorf("member not found")
+}
+
+func capitalize(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
+
+// ============================================================================
+// Member Handlers
+// ============================================================================
+
+func (s *Server) HandleGetMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	members, err := s.Repos.Member.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get members: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func (s *Server) HandleAddMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var member models.WorkspaceMember
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !validRole(member.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	member.WorkspaceID = workspaceID // Ensure workspace matches the URL parameter
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := s.Repos.User.GetByID(ctx, member.UserID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "User not found", http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, err := s.Repos.Member.Get(ctx, workspaceID, member.UserID); err == nil {
+		http.Error(w, "User is already a member", http.StatusConflict)
+		return
+	}
+
+	if err := s.Repos.Member.Add(ctx, &member); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityMember, EntityID: member.UserID, Action: models.ActionCreate,
+	}, nil, member)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (s *Server) HandleUpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+	userID := vars["userId"]
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !validRole(body.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if body.Role != models.RoleOwner && !s.keepsAnOwner(ctx, w, workspaceID, userID) {
+		return
+	}
+
+	before, err := s.Repos.Member.Get(ctx, workspaceID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Member not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get member: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.Repos.Member.UpdateRole(ctx, workspaceID, userID, body.Role); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Member not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update member role: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	member, err := s.Repos.Member.Get(ctx, workspaceID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get updated member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityMember, EntityID: userID, Action: models.ActionUpdate,
+	}, before, member)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// HandleRemoveMember removes a member. Owners may remove anybody, and every
+// member may remove themselves to leave a workspace.
+func (s *Server) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+	userID := vars["userId"]
+
+	role := models.RoleOwner
+	if token := requestToken(r); token != nil && token.UserID == userID {
+		role = models.RoleViewer
+	}
+
+	if _, ok := s.authorize(w, r, role); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !s.keepsAnOwner(ctx, w, workspaceID, userID) {
+		return
+	}
+
+	before, err := s.Repos.Member.Get(ctx, workspaceID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.Repos.Member.Remove(ctx, workspaceID, userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Member not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to remove member: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityMember, EntityID: userID, Action: models.ActionDelete,
+	}, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keepsAnOwner rejects changes that would take away the last owner of a
+// workspace, leaving nobody able to manage it.
+func (s *Server) keepsAnOwner(ctx context.Context, w http.ResponseWriter, workspaceID, userID string) bool {
+	member, err := s.Repos.Member.Get(ctx, workspaceID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Member not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get member: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+	if member.Role != models.RoleOwner {
+		return true
+	}
+
+	owners, err := s.Repos.Member.CountOwners(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count owners: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if owners <= 1 {
+		http.Error(w, "A workspace must keep at least one owner", http.StatusConflict)
+		return false
+	}
+
+	return true
+}
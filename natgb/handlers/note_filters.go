@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// parseNoteFilter reads the filter language of note listings:
+//
+//	priority=high,medium   notes with any of the priorities
+//	status=todo,review     notes in any of the statuses
+//	tag=bug,ui             notes with any of the tags
+//	completed=true         completed or pending notes
+//	ready=true             pending notes whose dependencies are all
+//	                       completed, or with false those still blocked
+//	q=text                 text in the head or note, ignoring case
+//	createdAfter=, createdBefore=, updatedAfter=, updatedBefore=,
+//	completedAfter=, completedBefore=, dueAfter=, dueBefore=
+//	                       RFC 3339 timestamps or YYYY-MM-DD dates; "after"
+//	                       is inclusive and "before" exclusive
+//	sort=priority,-updated fields to sort by, "-" for descending
+//	limit=50, cursor=      page size (max 200) and the nextCursor of the
+//	                       previous page
+func parseNoteFilter(query url.Values) (models.NoteFilter, error) {
+	filter := models.NoteFilter{
+		Priorities: splitList(query.Get("priority")),
+		Statuses:   splitList(query.Get("status")),
+		Tags:       splitList(query.Get("tag")),
+		Text:       strings.TrimSpace(query.Get("q")),
+		Cursor:     query.Get("cursor"),
+	}
+
+	if value := query.Get("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid completed, expected true or false")
+		}
+		filter.Completed = &completed
+	}
+
+	if value := query.Get("ready"); value != "" {
+		ready, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid ready, expected true or false")
+		}
+		filter.Ready = &ready
+	}
+
+	times := []struct {
+		name  string
+		field **time.Time
+	}{
+		{"createdAfter", &filter.CreatedAfter},
+		{"createdBefore", &filter.CreatedBefore},
+		{"updatedAfter", &filter.UpdatedAfter},
+		{"updatedBefore", &filter.UpdatedBefore},
+		{"completedAfter", &filter.CompletedAfter},
+		{"completedBefore", &filter.CompletedBefore},
+		{"dueAfter", &filter.DueAfter},
+		{"dueBefore", &filter.DueBefore},
+	}
+	for _, param := range times {
+		value, err := parseDateParam(query.Get(param.name))
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s, expected RFC 3339 or YYYY-MM-DD", param.name)
+		}
+		*param.field = value
+	}
+
+	for _, field := range splitList(query.Get("sort")) {
+		sort := models.NoteSort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		filter.Sort = append(filter.Sort, sort)
+	}
+
+	var err error
+	if filter.Limit, err = parseIntParam(query.Get("limit")); err != nil {
+		return filter, fmt.Errorf("invalid limit")
+	}
+
+	return filter, nil
+}
+
+// parseDateParam parses an optional RFC 3339 timestamp or a date, which
+// stands for the start of that day in server local time.
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &parsed, nil
+	}
+	return parseTimeParam(value)
+}
+
+// splitList splits a comma separated query parameter, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listNotes responds with a page of the notes matching the filter.
+func (s *Server) listNotes(w http.ResponseWriter, filter models.NoteFilter) {
+	ctx := context.Background()
+	page, err := s.Repos.Note.List(ctx, filter)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid sort field") || strings.Contains(err.Error(), "invalid cursor") {
+			http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get notes: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// ============================================================================
+// Note Listing Handlers
+// ============================================================================
+
+// HandleGetWorkspaceNotes lists the notes of all note blocks of a workspace,
+// filtered, sorted and paginated as described by parseNoteFilter.
+func (s *Server) HandleGetWorkspaceNotes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	filter, err := parseNoteFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	filter.WorkspaceIDs = []string{workspaceID}
+	s.listNotes(w, filter)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// checkPriority rejects a missing priority or one unknown to the workspace
+// with 422.
+func (s *Server) checkPriority(ctx context.Context, w http.ResponseWriter, workspaceID, priority string) bool {
+	if priority == "" {
+		http.Error(w, "Priority is required", http.StatusUnprocessableEntity)
+		return false
+	}
+
+	priorities, err := s.Repos.Priority.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get priorities: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	for _, known := range priorities {
+		if known.Name == priority {
+			return true
+		}
+	}
+
+	http.Error(w, fmt.Sprintf("Unknown priority %q", priority), http.StatusUnprocessableEntity)
+	return false
+}
+
+// validatePriorities checks new priorities. Priorities without a rank are
+// ranked by their position in the list, most urgent first.
+func validatePriorities(priorities []models.NotePriority) error {
+	if len(priorities) == 0 {
+		return fmt.Errorf("at least one priority is required")
+	}
+
+	seen := map[string]bool{}
+	for i := range priorities {
+		priority := &priorities[i]
+
+		priority.Name = strings.TrimSpace(priority.Name)
+		if priority.Name == "" || len(priority.Name) > 32 {
+			return fmt.Errorf("invalid priority name %q", priority.Name)
+		}
+		if seen[priority.Name] {
+			return fmt.Errorf("duplicate priority name %q", priority.Name)
+		}
+		seen[priority.Name] = true
+
+		if priority.Rank < 0 {
+			return fmt.Errorf("invalid rank for priority %q", priority.Name)
+		}
+		if priority.Rank == 0 {
+			priority.Rank = i + 1
+		}
+
+		if priority.Color != "" && !colorPattern.MatchString(priority.Color) {
+			return fmt.Errorf("invalid colour %q for priority %q", priority.Color, priority.Name)
+		}
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Priority Handlers
+// ============================================================================
+
+// HandleGetPriorities returns the priorities of a workspace by rank.
+func (s *Server) HandleGetPriorities(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	priorities, err := s.Repos.Priority.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get priorities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(priorities)
+}
+
+// HandleUpdatePriorities replaces the priorities of a workspace. Priorities
+// still used by notes cannot be removed.
+func (s *Server) HandleUpdatePriorities(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var priorities []models.NotePriority
+	if err := json.NewDecoder(r.Body).Decode(&priorities); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePriorities(priorities); err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	before, err := s.Repos.Priority.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get priorities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.Repos.Priority.Replace(ctx, workspaceID, priorities); err != nil {
+		if strings.Contains(err.Error(), "priority in use") {
+			http.Error(w, capitalize(err.Error()), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update priorities: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	after, err := s.Repos.Priority.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get priorities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityPriorities, EntityID: workspaceID, Action: models.ActionUpdate,
+	}, before, after)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
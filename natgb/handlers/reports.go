@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+	"github.com/tanjeetsarkar/nat/services"
+)
+
+// ============================================================================
+// Report Handlers
+// ============================================================================
+
+// HandleGetNoteEvents returns the completion history of a note, oldest first.
+func (s *Server) HandleGetNoteEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	events, err := s.Repos.NoteEvent.GetByNoteID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note events: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// HandleGetFlowReport returns the burndown and cumulative flow series of a
+// workspace for the days "from" through "to" (YYYY-MM-DD, server local time),
+// defaulting to the last 30 days.
+func (s *Server) HandleGetFlowReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	from, to, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	events, err := s.Repos.NoteEvent.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note events: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services.BuildFlowReport(workspaceID, events, from, to))
+}
+
+// reportRange parses the "from" and "to" dates of a report. It writes an
+// error response and returns false when they are invalid.
+func reportRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -(defaultStatsDays - 1))
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+
+	if to.Before(from) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if to.After(from.AddDate(0, 0, maxStatsDays-1)) {
+		http.Error(w, fmt.Sprintf("Range must not exceed %d days", maxStatsDays), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
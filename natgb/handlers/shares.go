@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// ============================================================================
+// Share Link Handlers
+// ============================================================================
+
+func (s *Server) HandleGetShareLinks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	links, err := s.Repos.Share.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get share links: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+func (s *Server) HandleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var link models.ShareLink
+	if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if link.Expires != nil && link.Expires.Before(time.Now()) {
+		http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	link.WorkspaceID = workspaceID // Ensure workspace matches the URL parameter
+	link.CreatedBy = requestToken(r).UserID
+
+	ctx := context.Background()
+	if link.NoteBlockID != nil {
+		blockWorkspaceID, err := s.Repos.NoteBlock.GetWorkspaceID(ctx, *link.NoteBlockID)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			http.Error(w, fmt.Sprintf("Failed to get note block: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err != nil || blockWorkspaceID != workspaceID {
+			http.Error(w, "Note block not found in workspace", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.Repos.Share.Create(ctx, &link); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create share link: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the plaintext token out of the audit log
+	recorded := link
+	recorded.Token = ""
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityShareLink, EntityID: formatID(link.ID), Action: models.ActionCreate,
+	}, nil, recorded)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (s *Server) HandleRevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+	idStr := vars["shareId"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid share link ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Share.Revoke(ctx, workspaceID, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to revoke share link: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityShareLink, EntityID: formatID(id), Action: models.ActionDelete,
+	}, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetSharedWorkspace serves a share link without authentication. The
+// response has the same shape as /workspaces/{id}/full; links to a single
+// note block contain only that block.
+func (s *Server) HandleGetSharedWorkspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	ctx := context.Background()
+	link, err := s.Repos.Share.Resolve(ctx, token)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "expired") {
+			http.Error(w, "Share link expired", http.StatusGone)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to resolve share link: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, link.WorkspaceID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if link.NoteBlockID != nil {
+		shared := []models.NoteBlock{}
+		for _, noteBlock := range workspace.Data.NoteBlocks {
+			if noteBlock.ID == *link.NoteBlockID {
+				shared = append(shared, noteBlock)
+			}
+		}
+		workspace.Data.NoteBlocks = shared
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(workspace)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+// ============================================================================
+// Statistics Handlers
+// ============================================================================
+
+// HandleGetWorkspaceStats reports note counts by block, priority and
+// completion, plus daily activity over a window given either as "days"
+// (default 30) ending now or as "since" and "until" timestamps.
+func (s *Server) HandleGetWorkspaceStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	since, until, ok := statsWindow(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	stats, err := s.Repos.Stats.GetWorkspaceStats(ctx, workspaceID, since, until)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// statsWindow parses the reporting window of a request. It writes an error
+// response and returns false when the parameters are invalid.
+func statsWindow(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+
+	days, err := parseIntParam(query.Get("days"))
+	if err != nil || days < 0 || days > maxStatsDays {
+		http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxStatsDays), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if days == 0 {
+		days = defaultStatsDays
+	}
+
+	since, err := parseTimeParam(query.Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid since timestamp", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	until, err := parseTimeParam(query.Get("until"))
+	if err != nil {
+		http.Error(w, "Invalid until timestamp", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+
+	end := time.Now()
+	if until != nil {
+		end = *until
+	}
+	start := end.AddDate(0, 0, -days)
+	if since != nil {
+		start = *since
+	}
+
+	if !start.Before(end) {
+		http.Error(w, "since must be before until", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if end.Sub(start) > maxStatsDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("Window must not exceed %d days", maxStatsDays), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+
+	return start, end, true
+}
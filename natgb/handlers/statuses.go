@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+var statusKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// checkStatus rejects a status unknown to the workspace with 422. An empty
+// status is derived from the completed flag.
+func (s *Server) checkStatus(ctx context.Context, w http.ResponseWriter, workspaceID, status string) bool {
+	if status == "" {
+		return true
+	}
+
+	statuses, err := s.Repos.Status.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get statuses: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	for _, known := range statuses {
+		if known.Key == status {
+			return true
+		}
+	}
+
+	http.Error(w, fmt.Sprintf("Unknown status %q", status), http.StatusUnprocessableEntity)
+	return false
+}
+
+// validateStatuses checks a new workflow and numbers its statuses in the
+// order given. A workflow needs a terminal status to complete notes in and a
+// non-terminal one to reopen them in.
+func validateStatuses(statuses []models.NoteStatus) error {
+	seen := map[string]bool{}
+	var terminal, open bool
+
+	for i := range statuses {
+		status := &statuses[i]
+		if !statusKeyPattern.MatchString(status.Key) {
+			return fmt.Errorf("invalid status key %q", status.Key)
+		}
+		if seen[status.Key] {
+			return fmt.Errorf("duplicate status key %q", status.Key)
+		}
+		seen[status.Key] = true
+
+		status.Name = strings.TrimSpace(status.Name)
+		if status.Name == "" {
+			status.Name = status.Key
+		}
+		status.Position = i
+
+		if status.Terminal {
+			terminal = true
+		} else {
+			open = true
+		}
+	}
+
+	if !terminal || !open {
+		return fmt.Errorf("statuses need at least one terminal and one non-terminal status")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Status Handlers
+// ============================================================================
+
+// HandleGetStatuses returns the statuses of a workspace in workflow order.
+func (s *Server) HandleGetStatuses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	statuses, err := s.Repos.Status.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get statuses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// HandleUpdateStatuses replaces the statuses of a workspace with the ordered
+// list in the body. Statuses still used by notes cannot be removed.
+func (s *Server) HandleUpdateStatuses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var statuses []models.NoteStatus
+	if err := json.NewDecoder(r.Body).Decode(&statuses); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateStatuses(statuses); err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	before, err := s.Repos.Status.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get statuses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.Repos.Status.Replace(ctx, workspaceID, statuses); err != nil {
+		if strings.Contains(err.Error(), "status in use") {
+			http.Error(w, capitalize(err.Error()), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update statuses: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityStatuses, EntityID: workspaceID, Action: models.ActionUpdate,
+	}, before, statuses)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// placeholderPattern matches "{{name}}", optionally with a day offset such
+// as "{{date+14}}".
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?:([+-])\s*(\d+))?\s*\}\}`)
+
+// expandPlaceholders replaces the placeholders in text. Custom variables take
+// precedence over the built-in date placeholders, and unknown placeholders
+// are left as they are.
+func expandPlaceholders(text string, now time.Time, variables map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := placeholderPattern.FindStringSubmatch(match)
+		name, sign, offset := parts[1], parts[2], parts[3]
+
+		if value, ok := variables[name]; ok && offset == "" {
+			return value
+		}
+
+		day := now
+		if offset != "" {
+			days, err := strconv.Atoi(offset)
+			if err != nil {
+				return match
+			}
+			if sign == "-" {
+				days = -days
+			}
+			day = now.AddDate(0, 0, days)
+		}
+
+		switch name {
+		case "date":
+			return day.Format("2006-01-02")
+		case "time":
+			return now.Format("15:04")
+		case "year":
+			return strconv.Itoa(day.Year())
+		case "month":
+			return day.Format("01")
+		case "day":
+			return day.Format("02")
+		case "weekday":
+			return day.Weekday().String()
+		case "week":
+			_, week := day.ISOWeek()
+			return fmt.Sprintf("%02d", week)
+		}
+		return match
+	})
+}
+
+// templateFromWorkspace captures the structure of a workspace, dropping IDs,
+// timestamps and completion state.
+func templateFromWorkspace(workspace *models.Workspace, includeNotes bool) []models.NoteBlock {
+	noteBlocks := []models.NoteBlock{}
+	for _, noteBlock := range workspace.Data.NoteBlocks {
+		block := models.NoteBlock{Head: noteBlock.Head}
+		if includeNotes {
+			for _, note := range noteBlock.Notes {
+				block.Notes = append(block.Notes, models.Note{Priority: note.Priority, Head: note.Head, Note: note.Note, Tags: note.Tags})
+			}
+		}
+		noteBlocks = append(noteBlocks, block)
+	}
+	return noteBlocks
+}
+
+// instantiateTemplate builds a new workspace from a template, expanding
+// placeholders in every piece of text.
+func instantiateTemplate(template *models.WorkspaceTemplate, id, name string, variables map[string]string) models.Workspace {
+	now := time.Now()
+	if name == "" {
+		name = template.Name
+	}
+
+	workspace := models.Workspace{
+		ID:   id,
+		Name: expandPlaceholders(name, now, variables),
+	}
+	workspace.Data.AppConfig.Title = expandPlaceholders(template.Title, now, variables)
+	workspace.Data.AppConfig.Metadata = models.Metadata{Created: now, Updated: now}
+
+	for _, noteBlock := range template.NoteBlocks {
+		block := models.NoteBlock{Head: expandPlaceholders(noteBlock.Head, now, variables)}
+		for _, note := range noteBlock.Notes {
+			block.Notes = append(block.Notes, models.Note{
+				Priority: note.Priority,
+				Head:     expandPlaceholders(note.Head, now, variables),
+				Note:     expandPlaceholders(note.Note, now, variables),
+				Tags:     note.Tags,
+			})
+		}
+		workspace.Data.NoteBlocks = append(workspace.Data.NoteBlocks, block)
+	}
+
+	return workspace
+}
+
+// ============================================================================
+// Template Handlers
+// ============================================================================
+
+// HandleCreateTemplate saves the structure of a workspace, and optionally its
+// notes, as a template owned by the caller.
+func (s *Server) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var request struct {
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		IncludeNotes bool   `json:"includeNotes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, workspaceID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	template := models.WorkspaceTemplate{
+		UserID:       requestToken(r).UserID,
+		Name:         request.Name,
+		Description:  request.Description,
+		Title:        workspace.Data.AppConfig.Title,
+		IncludeNotes: request.IncludeNotes,
+		NoteBlocks:   templateFromWorkspace(workspace, request.IncludeNotes),
+	}
+	if template.Name == "" {
+		template.Name = workspace.Name
+	}
+
+	if err := s.Repos.Template.Create(ctx, &template); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+func (s *Server) HandleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	templates, err := s.Repos.Template.GetByUserID(ctx, token.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get templates: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+func (s *Server) HandleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	template, ok := s.userTemplate(w, mux.Vars(r)["id"], token.UserID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func (s *Server) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Template.Delete(ctx, token.UserID, id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete template: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createWorkspaceFromTemplate handles POST /workspaces?template=<id>. The
+// optional body sets the workspace ID, its name (defaulting to the template
+// name) and custom placeholder variables.
+func (s *Server) createWorkspaceFromTemplate(w http.ResponseWriter, r *http.Request, token *models.APIToken, templateID string) {
+	var request struct {
+		ID        string            `json:"id"`
+		Name      string            `json:"name"`
+		Variables map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	template, ok := s.userTemplate(w, templateID, token.UserID)
+	if !ok {
+		return
+	}
+
+	workspace := instantiateTemplate(template, request.ID, request.Name, request.Variables)
+
+	// The creator owns the new workspace
+	ctx := context.Background()
+	if err := s.Repos.Workspace.Create(ctx, &workspace, token.UserID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspace.ID, EntityType: models.EntityWorkspace, EntityID: workspace.ID, Action: models.ActionCreate,
+	}, nil, workspace)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// userTemplate loads a template of the user. Templates of other users are
+// reported as not found.
+func (s *Server) userTemplate(w http.ResponseWriter, idStr, userID string) (*models.WorkspaceTemplate, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx := context.Background()
+	template, err := s.Repos.Template.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get template: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	if template.UserID != userID {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return template, true
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// todo.txt has a line per task. Priorities are letters, (A) being the most
+// urgent, and map to the priorities of a workspace by rank. Completed tasks
+// start with "x" and their completion date and keep their priority as
+// "pri:A". The note block is the +project, tags are @contexts, and the status
+// and due date are "status:" and "due:" tags. They all follow the text of
+// the task, so that text like "+1" stays in the head:
+//
+//	(A) 2024-05-01 Write the release notes +Backlog @docs status:review due:2024-05-10
+//	x 2024-05-03 2024-05-01 Tag the release +Backlog pri:B
+//
+// Note content has no place in the format and is left out.
+const todoTxtDate = "2006-01-02"
+
+// todoTxtDefaultBlock holds the imported tasks without a project.
+const todoTxtDefaultBlock = "Inbox"
+
+var todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+// todoTxtProject turns a note block head into a project name, which cannot
+// contain spaces. Imports turn the underscores back into spaces.
+func todoTxtProject(head string) string {
+	return strings.Join(strings.Fields(head), "_")
+}
+
+// todoTxtLetter returns the letter of a priority, or "" for priorities the
+// workspace does not have or past Z.
+func todoTxtLetter(priority string, vocabulary *noteVocabulary) string {
+	for i, name := range vocabulary.ranked {
+		if name == priority && i < 26 {
+			return string(rune('A' + i))
+		}
+	}
+	return ""
+}
+
+// renderTodoTxt writes the notes of a workspace as todo.txt lines.
+func renderTodoTxt(workspace *models.Workspace, vocabulary *noteVocabulary) []byte {
+	var b bytes.Buffer
+	for _, noteBlock := range workspace.Data.NoteBlocks {
+		project := todoTxtProject(noteBlock.Head)
+
+		for _, note := range noteBlock.Notes {
+			var fields []string
+			letter := todoTxtLetter(note.Priority, vocabulary)
+			completed := note.Metadata.Completed != nil && *note.Metadata.Completed
+
+			if completed {
+				fields = append(fields, "x")
+				if note.Metadata.CompletedAt != nil {
+					fields = append(fields, note.Metadata.CompletedAt.Format(todoTxtDate))
+				}
+			} else if letter != "" {
+				fields = append(fields, "("+letter+")")
+			}
+			// Completed tasks only have a creation date after their completion date
+			if !note.Metadata.Created.IsZero() && (!completed || note.Metadata.CompletedAt != nil) {
+				fields = append(fields, note.Metadata.Created.Format(todoTxtDate))
+			}
+
+			fields = append(fields, strings.Fields(note.Head)...)
+			if project != "" {
+				fields = append(fields, "+"+project)
+			}
+			for _, tag := range note.Tags {
+				fields = append(fields, "@"+todoTxtProject(tag))
+			}
+			if note.Status != "" {
+				fields = append(fields, "status:"+note.Status)
+			}
+			if note.Metadata.Due != nil {
+				fields = append(fields, "due:"+note.Metadata.Due.Format(todoTxtDate))
+			}
+			if completed && letter != "" {
+				fields = append(fields, "pri:"+letter)
+			}
+
+			b.WriteString(strings.Join(fields, " "))
+			b.WriteString("\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// parseTodoTxt reads note blocks from todo.txt lines, a note block per
+// project in order of appearance. Projects map to the existing note blocks
+// whose heads export as them; the others are new note blocks without an ID.
+// Errors name the line they were found on.
+func parseTodoTxt(document []byte, vocabulary *noteVocabulary, existing []models.NoteBlock) ([]models.NoteBlock, error) {
+	var noteBlocks []models.NoteBlock
+	blocks := map[string]int{}
+	var errs []error
+
+	scanner := bufio.NewScanner(bytes.NewReader(document))
+	scanner.Buffer(nil, maxDocumentSize)
+	for number := 1; scanner.Scan(); number++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		note, project, err := parseTodoTxtTask(fields, vocabulary)
+		if err == nil {
+			err = vocabulary.check(*note)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Line %d: %w", number, err))
+			continue
+		}
+
+		if project == "" {
+			project = todoTxtDefaultBlock
+		}
+		block, ok := blocks[project]
+		if !ok {
+			block = len(noteBlocks)
+			blocks[project] = block
+			noteBlocks = append(noteBlocks, todoTxtNoteBlock(project, existing))
+		}
+		noteBlocks[block].Notes = append(noteBlocks[block].Notes, *note)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return noteBlocks, nil
+}
+
+// todoTxtNoteBlock returns the note block a project stands for: the first
+// existing one whose head exports as the project, or else a new one.
+func todoTxtNoteBlock(project string, existing []models.NoteBlock) models.NoteBlock {
+	for _, noteBlock := range existing {
+		if todoTxtProject(noteBlock.Head) == project {
+			return models.NoteBlock{ID: noteBlock.ID, Head: noteBlock.Head, Metadata: noteBlock.Metadata}
+		}
+	}
+	return models.NoteBlock{Head: strings.ReplaceAll(project, "_", " ")}
+}
+
+// isTodoTxtTag reports whether a field is a project, a context or one of the
+// "key:value" tags notes are exported with.
+func isTodoTxtTag(field string) bool {
+	if len(field) > 1 && (field[0] == '+' || field[0] == '@') {
+		return true
+	}
+	key, value, _ := strings.Cut(field, ":")
+	switch key {
+	case "status", "due":
+		return value != ""
+	case "pri":
+		return len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z'
+	}
+	return false
+}
+
+// parseTodoTxtTask reads a note and its project from the fields of a line.
+// Tags are only read from the end of the line. The last project there is
+// the note block, and whatever comes before it is text, as exports write
+// tags after the project.
+func parseTodoTxtTask(fields []string, vocabulary *noteVocabulary) (*models.Note, string, error) {
+	note := &models.Note{}
+	completed := false
+	letter := ""
+
+	date := func() (*time.Time, error) {
+		if len(fields) == 0 {
+			return nil, nil
+		}
+		day, err := time.ParseInLocation(todoTxtDate, fields[0], time.Local)
+		if err != nil {
+			if len(fields[0]) == len(todoTxtDate) && strings.Count(fields[0], "-") == 2 {
+				return nil, fmt.Errorf("invalid date %q", fields[0])
+			}
+			return nil, nil
+		}
+		fields = fields[1:]
+		return &day, nil
+	}
+
+	if fields[0] == "x" {
+		completed = true
+		fields = fields[1:]
+		completedAt, err := date()
+		if err != nil {
+			return nil, "", err
+		}
+		note.Metadata.CompletedAt = completedAt
+	} else if match := todoTxtPriority.FindStringSubmatch(fields[0]); match != nil {
+		letter = match[1]
+		fields = fields[1:]
+	}
+	note.Metadata.Completed = &completed
+
+	created, err := date()
+	if err != nil {
+		return nil, "", err
+	}
+	if created != nil {
+		note.Metadata.Created = *created
+	}
+
+	end := len(fields)
+	for end > 0 && isTodoTxtTag(fields[end-1]) {
+		end--
+	}
+	for i := len(fields) - 1; i >= end; i-- {
+		if fields[i][0] == '+' {
+			end = i
+			break
+		}
+	}
+
+	var project string
+	for _, field := range fields[end:] {
+		key, value, _ := strings.Cut(field, ":")
+		switch {
+		case field[0] == '+':
+			project = field[1:]
+		case field[0] == '@':
+			note.Tags = append(note.Tags, field[1:])
+		case key == "status":
+			note.Status = value
+		case key == "due":
+			due, err := time.ParseInLocation(todoTxtDate, value, time.Local)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid due date %q", value)
+			}
+			note.Metadata.Due = &due
+		case key == "pri":
+			letter = value
+		}
+	}
+
+	note.Head = strings.Join(fields[:end], " ")
+	if note.Head == "" {
+		return nil, "", fmt.Errorf("task text is required")
+	}
+
+	if letter != "" {
+		i := int(letter[0] - 'A')
+		if i >= len(vocabulary.ranked) {
+			return nil, "", fmt.Errorf("no priority (%s) in a workspace with %d priorities", letter, len(vocabulary.ranked))
+		}
+		note.Priority = vocabulary.ranked[i]
+	}
+
+	return note, project, nil
+}
+
+// ============================================================================
+// todo.txt Handlers
+// ============================================================================
+
+// HandleExportTodoTxt exports the notes of a workspace as todo.txt lines.
+func (s *Server) HandleExportTodoTxt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleViewer); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	workspace, err := s.Repos.Workspace.GetWithFullHierarchy(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	vocabulary, err := s.noteVocabulary(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.todo.txt", workspace.ID))
+	w.Write(renderTodoTxt(workspace, vocabulary))
+}
+
+// HandleImportTodoTxt adds the tasks of a todo.txt file, sent as the request
+// body, to a workspace. Tasks go to the note block of their project, which is
+// created if the workspace has none. Nothing is imported unless every task
+// is valid; the errors are listed a line each.
+func (s *Server) HandleImportTodoTxt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleEditor); !ok {
+		return
+	}
+
+	document, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	vocabulary, err := s.noteVocabulary(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	existing, err := s.Repos.NoteBlock.GetByWorkspaceID(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get note blocks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	noteBlocks, err := parseTodoTxt(document, vocabulary, existing)
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+	if len(noteBlocks) == 0 {
+		http.Error(w, "Document has no tasks", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Remember which note blocks are new before they get IDs
+	created := make([]bool, len(noteBlocks))
+	for i, noteBlock := range noteBlocks {
+		created[i] = noteBlock.ID == 0
+	}
+
+	if err := s.Repos.Workspace.AddNotes(ctx, id, noteBlocks); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to import tasks: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	for i, noteBlock := range noteBlocks {
+		if created[i] {
+			s.recordMutation(r, models.AuditEntry{
+				WorkspaceID: id, EntityType: models.EntityNoteBlock, EntityID: formatID(noteBlock.ID), Action: models.ActionCreate,
+			}, nil, noteBlock)
+			continue
+		}
+		for _, note := range noteBlock.Notes {
+			s.recordMutation(r, models.AuditEntry{
+				WorkspaceID: id, EntityType: models.EntityNote, EntityID: formatID(note.ID), Action: models.ActionCreate,
+			}, nil, note)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(noteBlocks)
+}
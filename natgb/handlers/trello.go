@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// maxTrelloExportSize is the largest Trello export accepted. Exports carry
+// the board's whole action history, so they are larger than their cards.
+const maxTrelloExportSize = 64 << 20
+
+// trelloBoard is the part of a Trello board JSON export that is imported.
+type trelloBoard struct {
+	Name       string            `json:"name"`
+	Lists      []trelloList      `json:"lists"`
+	Cards      []trelloCard      `json:"cards"`
+	Checklists []trelloChecklist `json:"checklists"`
+}
+
+type trelloList struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	Pos  float64 `json:"pos"`
+}
+
+type trelloCard struct {
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Desc             string        `json:"desc"`
+	Closed           bool          `json:"closed"`
+	Due              *time.Time    `json:"due"`
+	DueComplete      bool          `json:"dueComplete"`
+	IDList           string        `json:"idList"`
+	Pos              float64       `json:"pos"`
+	Labels           []trelloLabel `json:"labels"`
+	DateLastActivity *time.Time    `json:"dateLastActivity"`
+}
+
+type trelloLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type trelloChecklist struct {
+	Name       string            `json:"name"`
+	IDCard     string            `json:"idCard"`
+	Pos        float64           `json:"pos"`
+	CheckItems []trelloCheckItem `json:"checkItems"`
+}
+
+type trelloCheckItem struct {
+	Name  string  `json:"name"`
+	State string  `json:"state"` // "complete" or "incomplete"
+	Pos   float64 `json:"pos"`
+}
+
+// trelloCreated reads the creation time Trello IDs start with, as Mongo
+// object IDs do.
+func trelloCreated(id string) time.Time {
+	if len(id) < 8 {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// trelloPriority returns the priority a label stands for, if its name is a
+// priority like "High" or "Priority: high".
+func trelloPriority(label trelloLabel, priorities []models.NotePriority) string {
+	words := strings.FieldsFunc(strings.ToLower(label.Name), func(r rune) bool {
+		return r == ' ' || r == ':' || r == '-' || r == '_'
+	})
+
+	var name []string
+	for _, word := range words {
+		if word != "priority" && word != "prio" {
+			name = append(name, word)
+		}
+	}
+	for _, priority := range priorities {
+		if strings.Join(name, " ") == priority.Name {
+			return priority.Name
+		}
+	}
+	return ""
+}
+
+// trelloNoteBlocks maps the lists of a board to note blocks and their cards
+// to notes, in board order. Labels naming a priority set the priority, the
+// most urgent one winning; other labels become tags. Checklists are appended
+// to the description as task lists, and closed cards are completed.
+func trelloNoteBlocks(board *trelloBoard, priorities []models.NotePriority) []models.NoteBlock {
+	ranks := map[string]int{}
+	for _, priority := range priorities {
+		ranks[priority.Name] = priority.Rank
+	}
+
+	checklists := map[string][]trelloChecklist{}
+	sort.SliceStable(board.Checklists, func(i, j int) bool { return board.Checklists[i].Pos < board.Checklists[j].Pos })
+	for _, checklist := range board.Checklists {
+		checklists[checklist.IDCard] = append(checklists[checklist.IDCard], checklist)
+	}
+
+	cards := map[string][]trelloCard{}
+	sort.SliceStable(board.Cards, func(i, j int) bool { return board.Cards[i].Pos < board.Cards[j].Pos })
+	for _, card := range board.Cards {
+		cards[card.IDList] = append(cards[card.IDList], card)
+	}
+
+	sort.SliceStable(board.Lists, func(i, j int) bool { return board.Lists[i].Pos < board.Lists[j].Pos })
+	noteBlocks := []models.NoteBlock{}
+	for _, list := range board.Lists {
+		noteBlock := models.NoteBlock{Head: list.Name}
+
+		for _, card := range cards[list.ID] {
+			completed := card.Closed || card.DueComplete
+			note := models.Note{Head: card.Name, Note: strings.TrimSpace(card.Desc)}
+			note.Metadata.Completed = &completed
+			note.Metadata.Created = trelloCreated(card.ID)
+			note.Metadata.Due = card.Due
+			if card.DateLastActivity != nil {
+				note.Metadata.Updated = *card.DateLastActivity
+			}
+
+			for _, label := range card.Labels {
+				if priority := trelloPriority(label, priorities); priority != "" {
+					if note.Priority == "" || ranks[priority] < ranks[note.Priority] {
+						note.Priority = priority
+					}
+				} else if label.Name != "" {
+					note.Tags = append(note.Tags, label.Name)
+				} else if label.Color != "" {
+					note.Tags = append(note.Tags, label.Color)
+				}
+			}
+
+			for _, checklist := range checklists[card.ID] {
+				items := checklist.CheckItems
+				sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+
+				lines := []string{checklist.Name}
+				for _, item := range items {
+					check := " "
+					if item.State == "complete" {
+						check = "x"
+					}
+					lines = append(lines, fmt.Sprintf("- [%s] %s", check, item.Name))
+				}
+				if note.Note != "" {
+					note.Note += "\n\n"
+				}
+				note.Note += strings.Join(lines, "\n")
+			}
+
+			noteBlock.Notes = append(noteBlock.Notes, note)
+		}
+
+		noteBlocks = append(noteBlocks, noteBlock)
+	}
+
+	return noteBlocks
+}
+
+// ============================================================================
+// Trello Handlers
+// ============================================================================
+
+// HandleImportTrello creates a workspace from a Trello board JSON export, sent
+// as the request body. The workspace is named after the board unless "name"
+// is given, and the caller owns it.
+func (s *Server) HandleImportTrello(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	var board trelloBoard
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTrelloExportSize)).Decode(&board); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Export is too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		}
+		return
+	}
+	if board.Lists == nil {
+		http.Error(w, "Not a Trello board export", http.StatusUnprocessableEntity)
+		return
+	}
+
+	workspace := models.Workspace{Name: board.Name}
+	if name := strings.TrimSpace(r.URL.Query().Get("name")); name != "" {
+		workspace.Name = name
+	}
+	if workspace.Name == "" {
+		workspace.Name = "Trello board"
+	}
+	// New workspaces start with the default priorities
+	workspace.Data.NoteBlocks = trelloNoteBlocks(&board, models.DefaultNotePriorities)
+
+	// The importer owns the new workspace
+	ctx := context.Background()
+	if err := s.Repos.Workspace.Create(ctx, &workspace, token.UserID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspace.ID, EntityType: models.EntityWorkspace, EntityID: workspace.ID, Action: models.ActionCreate,
+	}, nil, workspace)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// savedViewRequest defines a view. The filter is given either as an object
+// or as a query string in the filter language of note listings.
+type savedViewRequest struct {
+	Name        string            `json:"name"`
+	WorkspaceID *string           `json:"workspaceId"`
+	Filter      models.NoteFilter `json:"filter"`
+	Query       string            `json:"query"`
+}
+
+// viewFilter returns the filter of a view request without paging.
+func (request savedViewRequest) viewFilter() (models.NoteFilter, error) {
+	filter := request.Filter
+	if request.Query != "" {
+		values, err := url.ParseQuery(strings.TrimPrefix(request.Query, "?"))
+		if err != nil {
+			return filter, fmt.Errorf("invalid query")
+		}
+		if filter, err = parseNoteFilter(values); err != nil {
+			return filter, err
+		}
+	}
+
+	filter.Limit = 0
+	filter.Cursor = ""
+	return filter, nil
+}
+
+// visibleWorkspaces returns the workspaces the caller is a member of, or the
+// one workspace the token is limited to.
+func (s *Server) visibleWorkspaces(ctx context.Context, token *models.APIToken) ([]string, error) {
+	workspaces, err := s.Repos.Workspace.GetByUserID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaceIDs := []string{}
+	for _, workspace := range workspaces {
+		if token.WorkspaceID == nil || *token.WorkspaceID == workspace.ID {
+			workspaceIDs = append(workspaceIDs, workspace.ID)
+		}
+	}
+	return workspaceIDs, nil
+}
+
+// viewScope returns the workspaces a view is evaluated in: its own workspace,
+// or all workspaces visible to the caller for personal views.
+func (s *Server) viewScope(ctx context.Context, token *models.APIToken, view *models.SavedView) ([]string, error) {
+	if view.WorkspaceID != nil {
+		return []string{*view.WorkspaceID}, nil
+	}
+	return s.visibleWorkspaces(ctx, token)
+}
+
+// savedView loads a view the caller may access with the given role on its
+// workspace. Personal views of other users are reported as not found.
+func (s *Server) savedView(w http.ResponseWriter, r *http.Request, role string) (*models.SavedView, *models.APIToken, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return nil, nil, false
+	}
+
+	ctx := context.Background()
+	view, err := s.Repos.SavedView.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "View not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get view: %v", err), http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+
+	if view.WorkspaceID == nil {
+		if view.UserID != token.UserID {
+			http.Error(w, "View not found", http.StatusNotFound)
+			return nil, nil, false
+		}
+	} else if !s.authorizeWorkspace(w, token, *view.WorkspaceID, role) {
+		return nil, nil, false
+	}
+
+	return view, token, true
+}
+
+// checkViewFilter evaluates a filter once, which rejects unknown sort fields.
+func (s *Server) checkViewFilter(ctx context.Context, w http.ResponseWriter, token *models.APIToken, view *models.SavedView) bool {
+	filter := view.Filter
+	scope, err := s.viewScope(ctx, token, view)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	filter.WorkspaceIDs = scope
+	filter.Limit = 1
+
+	if _, err := s.Repos.Note.List(ctx, filter); err != nil {
+		if strings.Contains(err.Error(), "invalid sort field") {
+			http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to evaluate view: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	return true
+}
+
+// ============================================================================
+// Saved View Handlers
+// ============================================================================
+
+// HandleGetSavedViews returns the caller's personal views and the views of
+// their workspaces, optionally only those of the "workspaceId" workspace.
+func (s *Server) HandleGetSavedViews(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	ctx := context.Background()
+	workspaceIDs, err := s.visibleWorkspaces(ctx, token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	views, err := s.Repos.SavedView.GetVisible(ctx, token.UserID, workspaceIDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get views: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if workspaceID := r.URL.Query().Get("workspaceId"); workspaceID != "" {
+		filtered := []models.SavedView{}
+		for _, view := range views {
+			if view.WorkspaceID != nil && *view.WorkspaceID == workspaceID {
+				filtered = append(filtered, view)
+			}
+		}
+		views = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// HandleCreateSavedView creates a personal view, or a view of the
+// "workspaceId" workspace, which requires the editor role there.
+func (s *Server) HandleCreateSavedView(w http.ResponseWriter, r *http.Request) {
+	var request savedViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := request.viewFilter()
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	view := models.SavedView{Name: strings.TrimSpace(request.Name), WorkspaceID: request.WorkspaceID, Filter: filter}
+	if view.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	token := requestToken(r)
+	if token == nil {
+		unauthorized(w, "Authentication required")
+		return
+	}
+	view.UserID = token.UserID
+
+	if view.WorkspaceID != nil && !s.authorizeWorkspace(w, token, *view.WorkspaceID, models.RoleEditor) {
+		return
+	}
+
+	ctx := context.Background()
+	if !s.checkViewFilter(ctx, w, token, &view) {
+		return
+	}
+
+	if err := s.Repos.SavedView.Create(ctx, &view); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if view.WorkspaceID != nil {
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: *view.WorkspaceID, EntityType: models.EntitySavedView, EntityID: formatID(view.ID), Action: models.ActionCreate,
+		}, nil, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+func (s *Server) HandleGetSavedView(w http.ResponseWriter, r *http.Request) {
+	view, _, ok := s.savedView(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// HandleUpdateSavedView renames a view or replaces its filter. Views cannot
+// move between workspaces.
+func (s *Server) HandleUpdateSavedView(w http.ResponseWriter, r *http.Request) {
+	var request savedViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := request.viewFilter()
+	if err != nil {
+		http.Error(w, capitalize(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	before, token, ok := s.savedView(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	view := *before
+	view.Name = name
+	view.Filter = filter
+
+	ctx := context.Background()
+	if !s.checkViewFilter(ctx, w, token, &view) {
+		return
+	}
+
+	if err := s.Repos.SavedView.Update(ctx, &view); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "View not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update view: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if view.WorkspaceID != nil {
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: *view.WorkspaceID, EntityType: models.EntitySavedView, EntityID: formatID(view.ID), Action: models.ActionUpdate,
+		}, before, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+func (s *Server) HandleDeleteSavedView(w http.ResponseWriter, r *http.Request) {
+	view, _, ok := s.savedView(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.SavedView.Delete(ctx, view.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "View not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete view: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if view.WorkspaceID != nil {
+		s.recordMutation(r, models.AuditEntry{
+			WorkspaceID: *view.WorkspaceID, EntityType: models.EntitySavedView, EntityID: formatID(view.ID), Action: models.ActionDelete,
+		}, view, nil)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEvaluateSavedView returns a page of the notes matching a view, with
+// the note block and workspace of each. Personal views cover every workspace
+// the caller can read. Takes "limit" and "cursor" like note listings.
+func (s *Server) HandleEvaluateSavedView(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := parseIntParam(query.Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	view, token, ok := s.savedView(w, r, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	scope, err := s.viewScope(ctx, token, view)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	filter := view.Filter
+	filter.WorkspaceIDs = scope
+	filter.Limit = limit
+	filter.Cursor = query.Get("cursor")
+	s.listNotes(w, filter)
+}
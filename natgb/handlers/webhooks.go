@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// webhookEventTypes lists the events webhooks can subscribe to
+var webhookEventTypes = map[string]bool{
+	models.EventWorkspaceUpdated: true,
+	models.EventNoteBlockCreated: true,
+	models.EventNoteBlockUpdated: true,
+	models.EventNoteBlockDeleted: true,
+	models.EventNoteCreated:      true,
+	models.EventNoteUpdated:      true,
+	models.EventNoteDeleted:      true,
+	models.EventNoteCompleted:    true,
+	models.EventNoteReopened:     true,
+	models.EventAll:              true,
+}
+
+// dispatchEvents queues webhook deliveries for a recorded mutation. Like the
+// audit log, failures are logged because the mutation has already happened.
+func (s *Server) dispatchEvents(entry models.AuditEntry, before, after interface{}) {
+	if s.Webhooks == nil {
+		return
+	}
+
+	data := after
+	if data == nil {
+		data = before
+	}
+
+	ctx := context.Background()
+	for _, event := range webhookEvents(entry, before, after) {
+		if err := s.Webhooks.Enqueue(ctx, entry.WorkspaceID, event, entry.Actor, data); err != nil {
+			log.Printf("webhooks: failed to queue %s: %v", event, err)
+		}
+	}
+}
+
+// webhookEvents maps a mutation to the webhook events it triggers.
+func webhookEvents(entry models.AuditEntry, before, after interface{}) []string {
+	switch entry.EntityType {
+	case models.EntityWorkspace:
+		if entry.Action == models.ActionUpdate {
+			return []string{models.EventWorkspaceUpdated}
+		}
+
+	case models.EntityNoteBlock:
+		switch entry.Action {
+		case models.ActionCreate:
+			return []string{models.EventNoteBlockCreated}
+		case models.ActionUpdate:
+			return []string{models.EventNoteBlockUpdated}
+		case models.ActionDelete:
+			return []string{models.EventNoteBlockDeleted}
+		}
+
+	case models.EntityNote:
+		switch entry.Action {
+		case models.ActionCreate:
+			return []string{models.EventNoteCreated}
+		case models.ActionDelete:
+			return []string{models.EventNoteDeleted}
+		case models.ActionUpdate, models.ActionToggle:
+			var events []string
+			if entry.Action == models.ActionUpdate {
+				events = append(events, models.EventNoteUpdated)
+			}
+			wasCompleted, _ := noteCompleted(before)
+			isCompleted, ok := noteCompleted(after)
+			if ok && isCompleted != wasCompleted {
+				if isCompleted {
+					events = append(events, models.EventNoteCompleted)
+				} else {
+					events = append(events, models.EventNoteReopened)
+				}
+			}
+			return events
+		}
+	}
+
+	return nil
+}
+
+// noteCompleted extracts the completion state from a note snapshot.
+func noteCompleted(value interface{}) (bool, bool) {
+	note := noteSnapshot(value)
+	if note == nil || note.Metadata.Completed == nil {
+		return false, false
+	}
+	return *note.Metadata.Completed, true
+}
+
+// noteSnapshot returns the note passed as a snapshot value, if any.
+func noteSnapshot(value interface{}) *models.Note {
+	switch v := value.(type) {
+	case models.Note:
+		return &v
+	case *models.Note:
+		return v
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// validateWebhook checks the URL and subscribed events of a webhook.
+func validateWebhook(webhook *models.Webhook) error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	if len(webhook.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range webhook.Events {
+		if !webhookEventTypes[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Webhook Handlers
+// ============================================================================
+
+func (s *Server) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	ctx := context.Background()
+	webhooks, err := s.Repos.Webhook.GetByWorkspaceID(ctx, workspaceID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get webhooks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Secrets are only shown on creation
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (s *Server) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	webhook := models.Webhook{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhook(&webhook); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	webhook.WorkspaceID = workspaceID // Ensure workspace matches the URL parameter
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate secret: %v", err), http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = secret
+	}
+
+	ctx := context.Background()
+	if err := s.Repos.Webhook.Create(ctx, &webhook); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the secret out of the audit log
+	recorded := webhook
+	recorded.Secret = ""
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityWebhook, EntityID: formatID(webhook.ID), Action: models.ActionCreate,
+	}, nil, recorded)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (s *Server) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhook(&webhook); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	before, ok := s.workspaceWebhook(w, r, workspaceID)
+	if !ok {
+		return
+	}
+
+	webhook.ID = before.ID // Ensure ID matches the URL parameter
+	webhook.WorkspaceID = workspaceID
+	webhook.Created = before.Created
+	before.Secret = ""
+
+	ctx := context.Background()
+	if err := s.Repos.Webhook.Update(ctx, &webhook); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update webhook: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	webhook.Secret = "" // Secrets are only shown on creation
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityWebhook, EntityID: formatID(webhook.ID), Action: models.ActionUpdate,
+	}, before, webhook)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (s *Server) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	before, ok := s.workspaceWebhook(w, r, workspaceID)
+	if !ok {
+		return
+	}
+	before.Secret = ""
+
+	ctx := context.Background()
+	if err := s.Repos.Webhook.Delete(ctx, before.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete webhook: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.recordMutation(r, models.AuditEntry{
+		WorkspaceID: workspaceID, EntityType: models.EntityWebhook, EntityID: formatID(before.ID), Action: models.ActionDelete,
+	}, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetWebhookDeliveries returns the delivery history of a webhook,
+// newest first.
+func (s *Server) HandleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	limit, err := parseIntParam(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	webhook, ok := s.workspaceWebhook(w, r, workspaceID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	deliveries, err := s.Repos.Webhook.GetDeliveries(ctx, webhook.ID, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get webhook deliveries: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// HandlePingWebhook queues a ping delivery so receivers can be tested.
+func (s *Server) HandlePingWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+
+	if _, ok := s.authorize(w, r, models.RoleOwner); !ok {
+		return
+	}
+
+	webhook, ok := s.workspaceWebhook(w, r, workspaceID)
+	if !ok {
+		return
+	}
+
+	if s.Webhooks == nil {
+		http.Error(w, "Webhook delivery is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := context.Background()
+	delivery, err := s.Webhooks.Ping(ctx, webhook, requestToken(r).UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to queue ping: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// workspaceWebhook loads the webhook named by the {webhookId} route variable
+// and checks that it belongs to the workspace.
+func (s *Server) workspaceWebhook(w http.ResponseWriter, r *http.Request, workspaceID string) (*models.Webhook, bool) {
+	vars := mux.Vars(r)
+	idStr := vars["webhookId"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx := context.Background()
+	webhook, err := s.Repos.Webhook.GetByID(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get webhook: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	if webhook.WorkspaceID != workspaceID {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return webhook, true
+}
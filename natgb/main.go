@@ -4,17 +4,24 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/tanjeetsarkar/nat/database"
 	"github.com/tanjeetsarkar/nat/handlers"
 	"github.com/tanjeetsarkar/nat/repositories"
+	"github.com/tanjeetsarkar/nat/services"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	legacyOwner := flag.String("legacy-owner", "", "make this user the owner of workspaces without members")
+	flag.Parse()
+
 	// Initialize database
 	db, err := database.NewDatabase("todo.db")
 	if err != nil {
@@ -26,14 +33,71 @@ func main() {
 	noteBlockRepo := repositories.NewNoteBlockRepository(db.Conn)
 	noteRepo := repositories.NewNoteRepository(db.Conn)
 	workspaceRepo := repositories.NewWorkspaceRepository(db.Conn, noteBlockRepo, noteRepo)
+	userRepo := repositories.NewUserRepository(db.Conn)
+	tokenRepo := repositories.NewTokenRepository(db.Conn)
+	memberRepo := repositories.NewMemberRepository(db.Conn)
+	shareRepo := repositories.NewShareRepository(db.Conn)
+	auditRepo := repositories.NewAuditRepository(db.Conn)
+	webhookRepo := repositories.NewWebhookRepository(db.Conn)
+	operationRepo := repositories.NewOperationRepository(db.Conn)
+	templateRepo := repositories.NewTemplateRepository(db.Conn)
+	statsRepo := repositories.NewStatsRepository(db.Conn)
+	noteEventRepo := repositories.NewNoteEventRepository(db.Conn)
+	statusRepo := repositories.NewStatusRepository(db.Conn)
+	priorityRepo := repositories.NewPriorityRepository(db.Conn)
+	savedViewRepo := repositories.NewSavedViewRepository(db.Conn)
+	dependencyRepo := repositories.NewDependencyRepository(db.Conn)
+	commentRepo := repositories.NewCommentRepository(db.Conn)
+	attachmentRepo := repositories.NewAttachmentRepository(db.Conn)
+	calendarObjectRepo := repositories.NewCalendarObjectRepository(db.Conn)
 
 	repos := &repositories.Repositories{
-		Workspace: workspaceRepo,
-		NoteBlock: noteBlockRepo,
-		Note:      noteRepo,
+		Workspace:      workspaceRepo,
+		NoteBlock:      noteBlockRepo,
+		Note:           noteRepo,
+		User:           userRepo,
+		Token:          tokenRepo,
+		Member:         memberRepo,
+		Share:          shareRepo,
+		Audit:          auditRepo,
+		Webhook:        webhookRepo,
+		Operation:      operationRepo,
+		Template:       templateRepo,
+		Stats:          statsRepo,
+		NoteEvent:      noteEventRepo,
+		Status:         statusRepo,
+		Priority:       priorityRepo,
+		SavedView:      savedViewRepo,
+		Dependency:     dependencyRepo,
+		Comment:        commentRepo,
+		Attachment:     attachmentRepo,
+		CalendarObject: calendarObjectRepo,
+	}
+
+	// Workspaces created before memberships existed belong to no one until
+	// they are given an owner
+	if *legacyOwner != "" {
+		if _, err := userRepo.GetByID(context.Background(), *legacyOwner); err != nil {
+			log.Fatal("Failed to find legacy owner:", err)
+		}
+		assigned, err := memberRepo.AssignOrphaned(context.Background(), *legacyOwner)
+		if err != nil {
+			log.Fatal("Failed to assign legacy workspaces:", err)
+		}
+		log.Printf("Assigned %d workspaces without members to %s", assigned, *legacyOwner)
+	}
+
+	// Deliver webhooks in the background
+	webhooks := services.NewWebhookDispatcher(webhookRepo)
+	go webhooks.Run(context.Background())
+
+	// Keep attachment content next to the database
+	blobs, err := services.NewLocalBlobStore("attachments")
+	if err != nil {
+		log.Fatal("Failed to initialize blob store:", err)
 	}
 
-	server := &handlers.Server{Repos: repos}
+	server := &handlers.Server{Repos: repos, Webhooks: webhooks, Blobs: blobs}
 
 	// Set up router
 	router := mux.NewRouter()
@@ -41,6 +105,9 @@ func main() {
 	// Enable CORS
 	router.Use(corsMiddleware)
 
+	// Resolve bearer tokens and enforce their scopes
+	router.Use(server.AuthMiddleware)
+
 	// API routes
 	api := router.PathPrefix("/api/v1").Subrouter()
 
@@ -51,6 +118,62 @@ func main() {
 	api.HandleFunc("/workspaces/{id}", server.HandleUpdateWorkspace).Methods("PUT")
 	api.HandleFunc("/workspaces/{id}", server.HandleDeleteWorkspace).Methods("DELETE")
 	api.HandleFunc("/workspaces/{id}/full", server.HandleGetWorkspaceWithHierarchy).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/notes", server.HandleGetWorkspaceNotes).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/duplicate", server.HandleDuplicateWorkspace).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/stats", server.HandleGetWorkspaceStats).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/reports/flow", server.HandleGetFlowReport).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/export.md", server.HandleExportMarkdown).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/import.md", server.HandleImportMarkdown).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/import.csv", server.HandleImportCSV).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/export.txt", server.HandleExportTodoTxt).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/import.txt", server.HandleImportTodoTxt).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/calendar.ics", server.HandleGetWorkspaceCalendar).Methods("GET")
+
+	// Status routes
+	api.HandleFunc("/workspaces/{id}/statuses", server.HandleGetStatuses).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/statuses", server.HandleUpdateStatuses).Methods("PUT")
+
+	// Priority routes
+	api.HandleFunc("/workspaces/{id}/priorities", server.HandleGetPriorities).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/priorities", server.HandleUpdatePriorities).Methods("PUT")
+
+	// Workspace member routes
+	api.HandleFunc("/workspaces/{id}/members", server.HandleGetMembers).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/members", server.HandleAddMember).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/members/{userId}", server.HandleUpdateMemberRole).Methods("PUT")
+	api.HandleFunc("/workspaces/{id}/members/{userId}", server.HandleRemoveMember).Methods("DELETE")
+
+	// Share link routes
+	api.HandleFunc("/workspaces/{id}/shares", server.HandleGetShareLinks).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/shares", server.HandleCreateShareLink).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/shares/{shareId}", server.HandleRevokeShareLink).Methods("DELETE")
+
+	// Webhook routes
+	api.HandleFunc("/workspaces/{id}/webhooks", server.HandleGetWebhooks).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/webhooks", server.HandleCreateWebhook).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/webhooks/{webhookId}", server.HandleUpdateWebhook).Methods("PUT")
+	api.HandleFunc("/workspaces/{id}/webhooks/{webhookId}", server.HandleDeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/workspaces/{id}/webhooks/{webhookId}/deliveries", server.HandleGetWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/webhooks/{webhookId}/ping", server.HandlePingWebhook).Methods("POST")
+
+	// Undo/redo routes
+	api.HandleFunc("/workspaces/{id}/operations", server.HandleGetOperations).Methods("GET")
+	api.HandleFunc("/workspaces/{id}/undo", server.HandleUndo).Methods("POST")
+	api.HandleFunc("/workspaces/{id}/redo", server.HandleRedo).Methods("POST")
+
+	// Template routes
+	api.HandleFunc("/workspaces/{id}/templates", server.HandleCreateTemplate).Methods("POST")
+	api.HandleFunc("/templates", server.HandleGetTemplates).Methods("GET")
+	api.HandleFunc("/templates/{id}", server.HandleGetTemplate).Methods("GET")
+	api.HandleFunc("/templates/{id}", server.HandleDeleteTemplate).Methods("DELETE")
+
+	// Saved view routes
+	api.HandleFunc("/views", server.HandleGetSavedViews).Methods("GET")
+	api.HandleFunc("/views", server.HandleCreateSavedView).Methods("POST")
+	api.HandleFunc("/views/{id}", server.HandleGetSavedView).Methods("GET")
+	api.HandleFunc("/views/{id}", server.HandleUpdateSavedView).Methods("PUT")
+	api.HandleFunc("/views/{id}", server.HandleDeleteSavedView).Methods("DELETE")
+	api.HandleFunc("/views/{id}/notes", server.HandleEvaluateSavedView).Methods("GET")
 
 	// Note block routes
 	api.HandleFunc("/workspaces/{workspaceId}/noteblocks", server.HandleGetNoteBlocks).Methods("GET")
@@ -59,6 +182,7 @@ func main() {
 	api.HandleFunc("/noteblocks/{id}", server.HandleUpdateNoteBlock).Methods("PUT")
 	api.HandleFunc("/noteblocks/{id}", server.HandleDeleteNoteBlock).Methods("DELETE")
 	api.HandleFunc("/noteblocks/{id}/notes", server.HandleGetNotes).Methods("GET")
+	api.HandleFunc("/noteblocks/{id}/duplicate", server.HandleDuplicateNoteBlock).Methods("POST")
 
 	// Note routes
 	api.HandleFunc("/noteblocks/{noteBlockId}/notes", server.HandleCreateNote).Methods("POST")
@@ -66,15 +190,61 @@ func main() {
 	api.HandleFunc("/notes/{id}", server.HandleUpdateNote).Methods("PUT")
 	api.HandleFunc("/notes/{id}", server.HandleDeleteNote).Methods("DELETE")
 	api.HandleFunc("/notes/{id}/toggle", server.HandleToggleNoteCompleted).Methods("PATCH")
+	api.HandleFunc("/notes/{id}/events", server.HandleGetNoteEvents).Methods("GET")
 
-	// Filtering routes
-	api.HandleFunc("/noteblocks/{noteBlockId}/notes/priority/{priority}", server.HandleGetNotesByPriority).Methods("GET")
-	api.HandleFunc("/noteblocks/{noteBlockId}/notes/completed", server.HandleGetCompletedNotes).Methods("GET")
-	api.HandleFunc("/noteblocks/{noteBlockId}/notes/pending", server.HandleGetPendingNotes).Methods("GET")
+	// Note dependency routes
+	api.HandleFunc("/notes/{id}/dependencies", server.HandleGetDependencies).Methods("GET")
+	api.HandleFunc("/notes/{id}/dependencies", server.HandleAddDependency).Methods("POST")
+	api.HandleFunc("/notes/{id}/dependencies/{otherId}", server.HandleRemoveDependency).Methods("DELETE")
+
+	// Comment routes
+	api.HandleFunc("/notes/{id}/comments", server.HandleGetComments).Methods("GET")
+	api.HandleFunc("/notes/{id}/comments", server.HandleCreateComment).Methods("POST")
+	api.HandleFunc("/notes/{id}/comments/{commentId}", server.HandleUpdateComment).Methods("PUT")
+	api.HandleFunc("/notes/{id}/comments/{commentId}", server.HandleDeleteComment).Methods("DELETE")
+
+	// Attachment routes
+	api.HandleFunc("/notes/{id}/attachments", server.HandleGetAttachments).Methods("GET")
+	api.HandleFunc("/notes/{id}/attachments", server.HandleUploadAttachment).Methods("POST")
+	api.HandleFunc("/notes/{id}/attachments/{attachmentId}", server.HandleDownloadAttachment).Methods("GET")
+	api.HandleFunc("/notes/{id}/attachments/{attachmentId}", server.HandleDeleteAttachment).Methods("DELETE")
 
 	// Import/Export routes
 	api.HandleFunc("/export", server.HandleExportData).Methods("GET")
+	api.HandleFunc("/export.zip", server.HandleExportArchive).Methods("GET")
+	api.HandleFunc("/export.csv", server.HandleExportCSV).Methods("GET")
 	api.HandleFunc("/import", server.HandleImportData).Methods("POST")
+	api.HandleFunc("/import.zip", server.HandleImportArchive).Methods("POST")
+	api.HandleFunc("/import/trello", server.HandleImportTrello).Methods("POST")
+
+	// Audit log routes
+	api.HandleFunc("/audit", server.HandleGetAuditLog).Methods("GET")
+
+	// User and token routes
+	api.HandleFunc("/users", server.HandleCreateUser).Methods("POST")
+	api.HandleFunc("/users/me", server.HandleGetCurrentUser).Methods("GET")
+	api.HandleFunc("/users/me/calendar.ics", server.HandleGetUserCalendar).Methods("GET")
+	api.HandleFunc("/tokens", server.HandleGetTokens).Methods("GET")
+	api.HandleFunc("/tokens", server.HandleCreateToken).Methods("POST")
+	api.HandleFunc("/tokens/{id}", server.HandleRenameToken).Methods("PATCH")
+	api.HandleFunc("/tokens/{id}", server.HandleRevokeToken).Methods("DELETE")
+
+	// CalDAV, serving workspaces as task calendars
+	router.HandleFunc("/.well-known/caldav", server.HandleCalDAVWellKnown)
+	caldav := router.PathPrefix("/caldav").Subrouter()
+	caldav.Methods("OPTIONS").HandlerFunc(server.HandleCalDAVOptions)
+	caldav.HandleFunc("/", server.HandlePropfindCalDAVHome).Methods("PROPFIND")
+	caldav.HandleFunc("/{workspaceId}", server.HandlePropfindCalendar).Methods("PROPFIND")
+	caldav.HandleFunc("/{workspaceId}/", server.HandlePropfindCalendar).Methods("PROPFIND")
+	caldav.HandleFunc("/{workspaceId}", server.HandleReportCalendar).Methods("REPORT")
+	caldav.HandleFunc("/{workspaceId}/", server.HandleReportCalendar).Methods("REPORT")
+	caldav.HandleFunc("/{workspaceId}/{name}", server.HandlePropfindCalendarObject).Methods("PROPFIND")
+	caldav.HandleFunc("/{workspaceId}/{name}", server.HandleGetCalendarObject).Methods("GET", "HEAD")
+	caldav.HandleFunc("/{workspaceId}/{name}", server.HandlePutCalendarObject).Methods("PUT")
+	caldav.HandleFunc("/{workspaceId}/{name}", server.HandleDeleteCalendarObject).Methods("DELETE")
+
+	// Public read-only share links
+	router.HandleFunc("/share/{token}", server.HandleGetSharedWorkspace).Methods("GET")
 
 	// Health check
 	router.HandleFunc("/health", server.HandleHealthCheck).Methods("GET")
@@ -92,7 +262,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
-		if r.Method == "OPTIONS" {
+		// CalDAV clients discover the server with OPTIONS
+		if r.Method == "OPTIONS" && !strings.HasPrefix(r.URL.Path, "/caldav/") {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -1,14 +1,28 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Note represents individual todo items
 type Note struct {
 	ID       int64    `json:"id" db:"id"`
-	Priority string   `json:"priority" db:"priority"` // high, medium, low
+	Priority string   `json:"priority" db:"priority"` // Name of a workspace priority
+	Status   string   `json:"status" db:"status"`     // Key of a workspace status; decides Completed
 	Head     string   `json:"head" db:"head"`         // Title/summary
 	Note     string   `json:"note" db:"note"`         // Description/content
+	Tags     []string `json:"tags,omitempty" db:"tags"`
 	Metadata Metadata `json:"metadata" db:"metadata"`
+
+	BlockedBy []int64 `json:"blockedBy,omitempty" db:"-"` // Notes that must be completed first
+	Blocks    []int64 `json:"blocks,omitempty" db:"-"`    // Notes waiting for this one
+
+	CommentCount int          `json:"commentCount,omitempty" db:"-"` // Comments that are not deleted
+	Comments     []Comment    `json:"comments,omitempty" db:"-"`     // Comment threads, only in exports
+	Attachments  []Attachment `json:"attachments,omitempty" db:"-"`
+
+	NoteBlockID int64 `json:"-" db:"note_block_id"` // Hidden from JSON, used for DB relations
 }
 
 // NoteBlock represents a collection of notes (what frontend calls noteBlocks)
@@ -43,9 +57,81 @@ type Workspace struct {
 
 // Metadata represents the metadata structure used throughout
 type Metadata struct {
-	Created   time.Time `json:"created" db:"created"`
-	Updated   time.Time `json:"updated" db:"updated"`
-	Completed *bool     `json:"completed,omitempty" db:"completed"` // Only for notes
+	Created     time.Time  `json:"created" db:"created"`
+	Updated     time.Time  `json:"updated" db:"updated"`
+	Completed   *bool      `json:"completed,omitempty" db:"completed"`      // Only for notes
+	CompletedAt *time.Time `json:"completedAt,omitempty" db:"completed_at"` // Only for completed notes
+	Due         *time.Time `json:"due,omitempty" db:"due"`                  // Only for notes
+}
+
+// Comment is a remark on a note. Replies point to the comment they answer.
+// Deleted comments keep their place in the thread with an empty body.
+type Comment struct {
+	ID         int64      `json:"id" db:"id"`
+	NoteID     int64      `json:"noteId" db:"note_id"`
+	ParentID   *int64     `json:"parentId,omitempty" db:"parent_id"`
+	AuthorID   *string    `json:"authorId,omitempty" db:"author_id"` // Unset once the author is deleted
+	AuthorName string     `json:"authorName" db:"author_name"`
+	Body       string     `json:"body" db:"body"`
+	Created    time.Time  `json:"created" db:"created"`
+	Edited     *time.Time `json:"edited,omitempty" db:"edited"`
+	Deleted    *time.Time `json:"deleted,omitempty" db:"deleted"`
+	Replies    []Comment  `json:"replies,omitempty"`
+}
+
+// Attachment describes a file attached to a note. The content is kept in a
+// blob store under BlobKey.
+type Attachment struct {
+	ID          int64     `json:"id" db:"id"`
+	NoteID      int64     `json:"noteId" db:"note_id"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"contentType" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	Checksum    string    `json:"checksum" db:"checksum"` // Hex SHA-256 of the content
+	UploaderID  *string   `json:"uploaderId,omitempty" db:"uploader_id"`
+	Created     time.Time `json:"created" db:"created"`
+	BlobKey     string    `json:"-" db:"blob_key"`
+}
+
+// CalendarObject names the CalDAV resource of a note and keeps the UID the
+// client gave it. Notes without one are served as "note-{id}.ics".
+type CalendarObject struct {
+	NoteID int64  `json:"noteId" db:"note_id"`
+	Name   string `json:"name" db:"name"` // Last path segment, like "3f2a.ics"
+	UID    string `json:"uid" db:"uid"`
+}
+
+// NoteStatus is a step of the workflow of a workspace. Notes in a terminal
+// status count as completed.
+type NoteStatus struct {
+	Key      string `json:"key" db:"key"` // Stable identifier stored on notes, like "in_progress"
+	Name     string `json:"name" db:"name"`
+	Position int    `json:"position" db:"position"`
+	Terminal bool   `json:"terminal" db:"terminal"`
+}
+
+// DefaultNoteStatuses is the workflow of new workspaces
+var DefaultNoteStatuses = []NoteStatus{
+	{Key: "todo", Name: "To Do", Position: 0},
+	{Key: "in_progress", Name: "In Progress", Position: 1},
+	{Key: "blocked", Name: "Blocked", Position: 2},
+	{Key: "review", Name: "Review", Position: 3},
+	{Key: "done", Name: "Done", Position: 4, Terminal: true},
+}
+
+// NotePriority is a priority notes of a workspace can have. Lower ranks are
+// more urgent.
+type NotePriority struct {
+	Name  string `json:"name" db:"name"`
+	Rank  int    `json:"rank" db:"rank"`
+	Color string `json:"color" db:"color"` // Hex colour like "#e5484d"
+}
+
+// DefaultNotePriorities are the priorities of new workspaces
+var DefaultNotePriorities = []NotePriority{
+	{Name: "high", Rank: 1, Color: "#e5484d"},
+	{Name: "medium", Rank: 2, Color: "#f5a524"},
+	{Name: "low", Rank: 3, Color: "#30a46c"},
 }
 
 // ExportData represents the complete export structure
@@ -54,3 +140,390 @@ type ExportData struct {
 	Version    string      `json:"version"`
 	Workspaces []Workspace `json:"workspaces"`
 }
+
+// ArchiveManifest describes the files of an export archive. Imports check
+// every file against its size and checksum before applying anything.
+type ArchiveManifest struct {
+	Format     string        `json:"format"` // Always "nat-archive"
+	Version    int           `json:"version"`
+	ExportDate time.Time     `json:"exportDate"`
+	Data       string        `json:"data"` // Path of the ExportData document
+	Files      []ArchiveFile `json:"files"`
+}
+
+// ArchiveFile is a file listed in an archive manifest
+type ArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// CSVImport reports how the columns of a CSV document were mapped to note
+// fields and what was wrong with its rows. Only successful imports carry the
+// created NoteBlocks.
+type CSVImport struct {
+	Columns    map[string]string `json:"columns"`           // Header to note field
+	Ignored    []string          `json:"ignored,omitempty"` // Headers not mapped to a field
+	Rows       int               `json:"rows"`
+	Errors     []CSVRowError     `json:"errors,omitempty"`
+	NoteBlocks []NoteBlock       `json:"noteBlocks,omitempty"`
+}
+
+// CSVRowError is a problem with a row of a CSV document. Rows are numbered
+// as in spreadsheets, the header being row 1.
+type CSVRowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// User represents an account that owns personal access tokens
+type User struct {
+	ID      string    `json:"id" db:"id"` // String ID like "user_1a2b3c4d"
+	Name    string    `json:"name" db:"name"`
+	Created time.Time `json:"created" db:"created"`
+}
+
+// APIToken represents a long-lived personal access token. Only a hash of the
+// secret is stored; the plaintext Token is returned once, on creation.
+type APIToken struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      string     `json:"userId" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	Prefix      string     `json:"prefix" db:"prefix"`                      // First characters of the token, for identification
+	ReadOnly    bool       `json:"readOnly" db:"read_only"`                 // Only safe methods are allowed
+	WorkspaceID *string    `json:"workspaceId,omitempty" db:"workspace_id"` // Limits the token to one workspace
+	Created     time.Time  `json:"created" db:"created"`
+	LastUsed    *time.Time `json:"lastUsed,omitempty" db:"last_used"`
+	Revoked     *time.Time `json:"revoked,omitempty" db:"revoked"`
+	Token       string     `json:"token,omitempty" db:"-"` // Plaintext, only set on creation
+}
+
+// Workspace member roles, from most to least privileged
+const (
+	RoleOwner     = "owner"     // Manages members and can delete the workspace
+	RoleEditor    = "editor"    // Creates and changes note blocks and notes
+	RoleCommenter = "commenter" // Reads and discusses notes
+	RoleViewer    = "viewer"    // Reads only
+)
+
+// WorkspaceMember grants a user a role on a workspace
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"workspaceId" db:"workspace_id"`
+	UserID      string    `json:"userId" db:"user_id"`
+	Role        string    `json:"role" db:"role"`
+	Created     time.Time `json:"created" db:"created"`
+}
+
+// ShareLink grants anonymous read-only access to a workspace, or to a single
+// note block of it. Only a hash of the secret is stored; the plaintext Token
+// is returned once, on creation.
+type ShareLink struct {
+	ID          int64      `json:"id" db:"id"`
+	WorkspaceID string     `json:"workspaceId" db:"workspace_id"`
+	NoteBlockID *int64     `json:"noteBlockId,omitempty" db:"note_block_id"` // Limits the link to one note block
+	Prefix      string     `json:"prefix" db:"prefix"`
+	CreatedBy   string     `json:"createdBy" db:"created_by"`
+	Created     time.Time  `json:"created" db:"created"`
+	Expires     *time.Time `json:"expires,omitempty" db:"expires"`
+	Revoked     *time.Time `json:"revoked,omitempty" db:"revoked"`
+	Token       string     `json:"token,omitempty" db:"-"` // Plaintext, only set on creation
+}
+
+// Audited entity types
+const (
+	EntityWorkspace  = "workspace"
+	EntityNoteBlock  = "note_block"
+	EntityNote       = "note"
+	EntityMember     = "member"
+	EntityShareLink  = "share_link"
+	EntityWebhook    = "webhook"
+	EntityStatuses   = "statuses"
+	EntityPriorities = "priorities"
+	EntitySavedView  = "saved_view"
+	EntityDependency = "dependency"
+	EntityComment    = "comment"
+	EntityAttachment = "attachment"
+)
+
+// Audited actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionToggle = "toggle"
+)
+
+// AuditEntry records a single mutation. Entries are append-only.
+type AuditEntry struct {
+	ID          int64           `json:"id" db:"id"`
+	WorkspaceID string          `json:"workspaceId" db:"workspace_id"`
+	EntityType  string          `json:"entityType" db:"entity_type"`
+	EntityID    string          `json:"entityId" db:"entity_id"`
+	Action      string          `json:"action" db:"action"`
+	Actor       string          `json:"actor" db:"actor"` // User ID
+	Timestamp   time.Time       `json:"timestamp" db:"timestamp"`
+	Before      json.RawMessage `json:"before,omitempty" db:"before"` // Snapshot before the mutation
+	After       json.RawMessage `json:"after,omitempty" db:"after"`   // Snapshot after the mutation
+	Owners      []string        `json:"owners,omitempty" db:"owners"` // Owners of a deleted workspace
+}
+
+// AuditFilter selects audit entries. Empty fields match everything.
+type AuditFilter struct {
+	WorkspaceID string
+	EntityType  string
+	EntityID    string
+	Action      string
+	Actor       string
+	Since       *time.Time
+	Until       *time.Time
+	Limit       int
+	Offset      int
+}
+
+// AuditPage is one page of audit entries along with the total match count
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+// NoteSort orders note listings by a field
+type NoteSort struct {
+	Field string `json:"field"` // id, head, priority, status, created, updated, completedAt, due or noteBlock
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// NoteFilter selects notes. Lists match notes with any of their values and
+// empty fields match everything.
+type NoteFilter struct {
+	WorkspaceIDs    []string   `json:"-"`
+	NoteBlockID     int64      `json:"-"`
+	Priorities      []string   `json:"priorities,omitempty"`
+	Statuses        []string   `json:"statuses,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	Completed       *bool      `json:"completed,omitempty"`
+	Ready           *bool      `json:"ready,omitempty"` // Pending notes whose dependencies are all completed, or when false the others
+	Text            string     `json:"text,omitempty"`  // Case-insensitive substring of the head or note
+	CreatedAfter    *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore   *time.Time `json:"createdBefore,omitempty"`
+	UpdatedAfter    *time.Time `json:"updatedAfter,omitempty"`
+	UpdatedBefore   *time.Time `json:"updatedBefore,omitempty"`
+	CompletedAfter  *time.Time `json:"completedAfter,omitempty"`
+	CompletedBefore *time.Time `json:"completedBefore,omitempty"`
+	DueAfter        *time.Time `json:"dueAfter,omitempty"`
+	DueBefore       *time.Time `json:"dueBefore,omitempty"`
+	Sort            []NoteSort `json:"sort,omitempty"`
+	Limit           int        `json:"-"`
+	Cursor          string     `json:"-"` // Opaque position returned as NextCursor
+}
+
+// ListedNote is a note in a listing, along with where it lives
+type ListedNote struct {
+	Note
+	NoteBlockID   int64  `json:"noteBlockId"`
+	NoteBlockHead string `json:"noteBlockHead"`
+	WorkspaceID   string `json:"workspaceId"`
+	WorkspaceName string `json:"workspaceName"`
+}
+
+// NotePage is one page of notes along with the total match count
+type NotePage struct {
+	Notes      []ListedNote `json:"notes"`
+	Total      int          `json:"total"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// NoteDependencies are the notes a note is blocked by and blocks
+type NoteDependencies struct {
+	NoteID    int64  `json:"noteId"`
+	BlockedBy []Note `json:"blockedBy"`
+	Blocks    []Note `json:"blocks"`
+}
+
+// SavedView is a named note filter. Personal views belong to a user and
+// span all of their workspaces; workspace views are shared with the members
+// of one workspace.
+type SavedView struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      string     `json:"userId" db:"user_id"` // Creator
+	WorkspaceID *string    `json:"workspaceId,omitempty" db:"workspace_id"`
+	Name        string     `json:"name" db:"name"`
+	Filter      NoteFilter `json:"filter" db:"filter"`
+	Created     time.Time  `json:"created" db:"created"`
+	Updated     time.Time  `json:"updated" db:"updated"`
+}
+
+// Webhook event types
+const (
+	EventWorkspaceUpdated = "workspace.updated"
+	EventNoteBlockCreated = "noteblock.created"
+	EventNoteBlockUpdated = "noteblock.updated"
+	EventNoteBlockDeleted = "noteblock.deleted"
+	EventNoteCreated      = "note.created"
+	EventNoteUpdated      = "note.updated"
+	EventNoteDeleted      = "note.deleted"
+	EventNoteCompleted    = "note.completed"
+	EventNoteReopened     = "note.reopened"
+	EventPing             = "ping"
+	EventAll              = "*" // Subscribes to every event
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook subscribes a URL to events of a workspace. Payloads are signed with
+// Secret, which is only returned on creation.
+type Webhook struct {
+	ID          int64     `json:"id" db:"id"`
+	WorkspaceID string    `json:"workspaceId" db:"workspace_id"`
+	URL         string    `json:"url" db:"url"`
+	Events      []string  `json:"events" db:"events"`
+	Secret      string    `json:"secret,omitempty" db:"secret"`
+	Active      bool      `json:"active" db:"active"`
+	Created     time.Time `json:"created" db:"created"`
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID           int64           `json:"id" db:"id"`
+	WebhookID    int64           `json:"webhookId" db:"webhook_id"`
+	Event        string          `json:"event" db:"event"`
+	Payload      json.RawMessage `json:"payload" db:"payload"`
+	Status       string          `json:"status" db:"status"` // pending, succeeded, failed
+	Attempts     int             `json:"attempts" db:"attempts"`
+	ResponseCode *int            `json:"responseCode,omitempty" db:"response_code"`
+	Error        string          `json:"error,omitempty" db:"error"`
+	NextAttempt  *time.Time      `json:"nextAttempt,omitempty" db:"next_attempt"`
+	Created      time.Time       `json:"created" db:"created"`
+	Delivered    *time.Time      `json:"delivered,omitempty" db:"delivered"`
+}
+
+// WebhookPayload is the JSON body posted to webhook URLs
+type WebhookPayload struct {
+	Event       string      `json:"event"`
+	WorkspaceID string      `json:"workspaceId"`
+	Actor       string      `json:"actor,omitempty"`
+	Timestamp   time.Time   `json:"timestamp"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+// Operation is an invertible mutation in a workspace's undo history. Before
+// and After hold snapshots of the entity, ParentID the note block of a note.
+type Operation struct {
+	ID          int64           `json:"id" db:"id"`
+	WorkspaceID string          `json:"workspaceId" db:"workspace_id"`
+	EntityType  string          `json:"entityType" db:"entity_type"`
+	EntityID    string          `json:"entityId" db:"entity_id"`
+	ParentID    string          `json:"parentId,omitempty" db:"parent_id"`
+	Action      string          `json:"action" db:"action"`
+	Actor       string          `json:"actor" db:"actor"`
+	Created     time.Time       `json:"created" db:"created"`
+	Undone      bool            `json:"undone" db:"undone"`
+	Before      json.RawMessage `json:"before,omitempty" db:"before"`
+	After       json.RawMessage `json:"after,omitempty" db:"after"`
+}
+
+// WorkspaceTemplate is a reusable workspace structure. Text may contain
+// placeholders such as {{date}} that are expanded on instantiation.
+type WorkspaceTemplate struct {
+	ID           int64       `json:"id" db:"id"`
+	UserID       string      `json:"userId" db:"user_id"`
+	Name         string      `json:"name" db:"name"`
+	Description  string      `json:"description" db:"description"`
+	Title        string      `json:"title" db:"title"` // App config title of created workspaces
+	IncludeNotes bool        `json:"includeNotes" db:"include_notes"`
+	NoteBlocks   []NoteBlock `json:"noteBlocks" db:"note_blocks"`
+	Created      time.Time   `json:"created" db:"created"`
+}
+
+// CompletionCount counts notes and how many of them are completed.
+type CompletionCount struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+// NoteBlockStats summarizes the notes of one note block.
+type NoteBlockStats struct {
+	NoteBlockID          int64                      `json:"noteBlockId"`
+	Head                 string                     `json:"head"`
+	Total                int                        `json:"total"`
+	Completed            int                        `json:"completed"`
+	CompletionPercentage float64                    `json:"completionPercentage"`
+	ByPriority           map[string]CompletionCount `json:"byPriority"`
+}
+
+// DailyStats counts the notes created and completed on one day.
+type DailyStats struct {
+	Date      string `json:"date"` // YYYY-MM-DD in server local time
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// WorkspaceStats summarizes the notes of a workspace. Daily counts and the
+// average time to complete cover the window from Since to Until.
+type WorkspaceStats struct {
+	WorkspaceID              string                     `json:"workspaceId"`
+	Since                    time.Time                  `json:"since"`
+	Until                    time.Time                  `json:"until"`
+	Total                    int                        `json:"total"`
+	Completed                int                        `json:"completed"`
+	CompletionPercentage     float64                    `json:"completionPercentage"`
+	ByPriority               map[string]CompletionCount `json:"byPriority"`
+	NoteBlocks               []NoteBlockStats           `json:"noteBlocks"`
+	Daily                    []DailyStats               `json:"daily"`
+	AverageCompletionSeconds *float64                   `json:"averageCompletionSeconds"` // Nil when nothing was completed
+}
+
+// Note event types
+const (
+	NoteEventCreated   = "created"
+	NoteEventCompleted = "completed"
+	NoteEventReopened  = "reopened"
+	NoteEventDeleted   = "deleted"
+)
+
+// NoteEvent is a change in the lifecycle of a note.
+type NoteEvent struct {
+	ID          int64     `json:"id" db:"id"`
+	WorkspaceID string    `json:"workspaceId" db:"workspace_id"`
+	NoteBlockID int64     `json:"noteBlockId" db:"note_block_id"`
+	NoteID      int64     `json:"noteId" db:"note_id"`
+	Event       string    `json:"event" db:"event"`
+	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+}
+
+// FlowPoint is the state of a workspace at the end of a day, for cumulative
+// flow diagrams, with the events of that day.
+type FlowPoint struct {
+	Date      string `json:"date"` // YYYY-MM-DD in server local time
+	Open      int    `json:"open"`
+	Done      int    `json:"done"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	Reopened  int    `json:"reopened"`
+	Deleted   int    `json:"deleted"`
+}
+
+// BurndownPoint is the remaining work at the end of a day next to the ideal
+// straight line from the remaining work at the start of the range to zero.
+type BurndownPoint struct {
+	Date      string  `json:"date"`
+	Remaining int     `json:"remaining"`
+	Ideal     float64 `json:"ideal"`
+}
+
+// FlowReport holds the burndown and cumulative flow series of a workspace
+// over a range of days.
+type FlowReport struct {
+	WorkspaceID    string          `json:"workspaceId"`
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	CumulativeFlow []FlowPoint     `json:"cumulativeFlow"`
+	Burndown       []BurndownPoint `json:"burndown"`
+}
@@ -0,0 +1,215 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type attachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+// attachmentColumns lists the columns scanAttachment expects, in order.
+const attachmentColumns = `id, note_id, filename, content_type, size, checksum, uploader_id, created, blob_key`
+
+func (r *attachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	if attachment.Created.IsZero() {
+		attachment.Created = time.Now()
+	}
+
+	query := `INSERT INTO attachments (note_id, filename, content_type, size, checksum, blob_key, uploader_id, created)
+			  VALUES (?, ?, ?, ?, ?, ?, (SELECT id FROM users WHERE id = ?), ?) RETURNING id`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		attachment.NoteID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.Checksum,
+		attachment.BlobKey, attachment.UploaderID, attachment.Created).Scan(&attachment.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) GetByID(ctx context.Context, id int64) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = ?`
+
+	attachment, err := scanAttachment(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("attachment not found")
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+func (r *attachmentRepository) GetByNoteID(ctx context.Context, noteID int64) ([]models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE note_id = ? ORDER BY id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, nil
+}
+
+// Delete removes the metadata of an attachment. Its blob is left for
+// GetOrphanedBlobs.
+func (r *attachmentRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM attachments WHERE id = ?`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("attachment not found")
+	}
+
+	return nil
+}
+
+// GetOrphanedBlobs returns the keys of blobs whose attachments were deleted,
+// directly or with their note, note block or workspace.
+func (r *attachmentRepository) GetOrphanedBlobs(ctx context.Context) ([]string, error) {
+	query := `SELECT blob_key FROM orphaned_blobs ORDER BY blob_key ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orphaned blobs: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan orphaned blob: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// ForgetOrphanedBlob drops a blob from the orphans once it is removed.
+func (r *attachmentRepository) ForgetOrphanedBlob(ctx context.Context, key string) error {
+	query := `DELETE FROM orphaned_blobs WHERE blob_key = ?`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("failed to forget orphaned blob: %w", err)
+	}
+
+	return nil
+}
+
+// insertAttachments adds the attachments of an imported note whose content
+// is stored under their BlobKey, skipping the others, and returns those added.
+// Like comments, only the importer's own uploads keep their uploader.
+func insertAttachments(ctx context.Context, db dbtx, noteID int64, importerID string, attachments []models.Attachment) ([]models.Attachment, error) {
+	query := `INSERT INTO attachments (note_id, filename, content_type, size, checksum, blob_key, uploader_id, created)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	var inserted []models.Attachment
+	for _, attachment := range attachments {
+		if attachment.BlobKey == "" {
+			continue
+		}
+		if attachment.Created.IsZero() {
+			attachment.Created = time.Now()
+		}
+		attachment.NoteID = noteID
+		if importerID == "" || attachment.UploaderID == nil || *attachment.UploaderID != importerID {
+			attachment.UploaderID = nil
+		}
+
+		err := db.QueryRowContext(ctx, query, noteID, attachment.Filename, attachment.ContentType, attachment.Size,
+			attachment.Checksum, attachment.BlobKey, attachment.UploaderID, attachment.Created).Scan(&attachment.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attachment: %w", err)
+		}
+		inserted = append(inserted, attachment)
+	}
+
+	return inserted, nil
+}
+
+// attachAttachments fills in the attachments of each note.
+func attachAttachments(ctx context.Context, db dbtx, notes []models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]*models.Note, len(notes))
+	ids := make([]interface{}, len(notes))
+	for i := range notes {
+		index[notes[i].ID] = &notes[i]
+		ids[i] = notes[i].ID
+	}
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments
+			  WHERE note_id IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)
+			  ORDER BY id ASC`
+
+	rows, err := db.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		note := index[attachment.NoteID]
+		note.Attachments = append(note.Attachments, *attachment)
+	}
+
+	return nil
+}
+
+func scanAttachment(row rowScanner) (*models.Attachment, error) {
+	attachment := &models.Attachment{}
+	var uploaderID sql.NullString
+
+	err := row.Scan(&attachment.ID, &attachment.NoteID, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.Checksum, &uploaderID, &attachment.Created, &attachment.BlobKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if uploaderID.Valid {
+		attachment.UploaderID = &uploaderID.String
+	}
+
+	return attachment, nil
+}
@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Append(ctx context.Context, entry *models.AuditEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	var owners []byte
+	if entry.Owners != nil {
+		var err error
+		if owners, err = json.Marshal(entry.Owners); err != nil {
+			return fmt.Errorf("failed to encode audit owners: %w", err)
+		}
+	}
+
+	query := `INSERT INTO audit_log (workspace_id, entity_type, entity_id, action, actor, timestamp, before, after, owners)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err := r.db.QueryRowContext(ctx, query,
+		entry.WorkspaceID, entry.EntityType, entry.EntityID, entry.Action, entry.Actor, entry.Timestamp,
+		nullableJSON(entry.Before), nullableJSON(entry.After), nullableJSON(owners)).Scan(&entry.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the newest entries matching the filter first.
+func (r *auditRepository) List(ctx context.Context, filter models.AuditFilter) (*models.AuditPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, value)
+	}
+
+	addCondition("workspace_id = ?", filter.WorkspaceID)
+	if filter.EntityType != "" {
+		addCondition("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		addCondition("entity_id = ?", filter.EntityID)
+	}
+	if filter.Action != "" {
+		addCondition("action = ?", filter.Action)
+	}
+	if filter.Actor != "" {
+		addCondition("actor = ?", filter.Actor)
+	}
+	// Timestamps are stored as text in local time, so compare in local time
+	if filter.Since != nil {
+		addCondition("timestamp >= ?", filter.Since.Local())
+	}
+	if filter.Until != nil {
+		addCondition("timestamp < ?", filter.Until.Local())
+	}
+
+	where := strings.Join(conditions, " AND ")
+
+	page := &models.AuditPage{Entries: []models.AuditEntry{}, Limit: filter.Limit, Offset: filter.Offset}
+
+	countQuery := `SELECT COUNT(*) FROM audit_log WHERE ` + where
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	query := `SELECT id, workspace_id, entity_type, entity_id, action, actor, timestamp, before, after, owners
+			  FROM audit_log WHERE ` + where + ` ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after, owners sql.NullString
+
+		err := rows.Scan(
+			&entry.ID, &entry.WorkspaceID, &entry.EntityType, &entry.EntityID,
+			&entry.Action, &entry.Actor, &entry.Timestamp, &before, &after, &owners,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+
+		// Handle nullable snapshots
+		if before.Valid {
+			entry.Before = []byte(before.String)
+		}
+		if after.Valid {
+			entry.After = []byte(after.String)
+		}
+		if owners.Valid {
+			if err := json.Unmarshal([]byte(owners.String), &entry.Owners); err != nil {
+				return nil, fmt.Errorf("failed to decode audit owners: %w", err)
+			}
+		}
+
+		page.Entries = append(page.Entries, entry)
+	}
+
+	return page, nil
+}
+
+// OwnedAtDeletion reports whether the user owned the workspace when it was
+// last deleted. It is used to grant access to the trail of deleted
+// workspaces.
+func (r *auditRepository) OwnedAtDeletion(ctx context.Context, workspaceID, userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM json_each((
+				SELECT owners FROM audit_log WHERE workspace_id = ? AND entity_type = ? AND action = ?
+				ORDER BY timestamp DESC, id DESC LIMIT 1)) WHERE value = ?)`
+
+	var owned bool
+	err := r.db.QueryRowContext(ctx, query, workspaceID, models.EntityWorkspace, models.ActionDelete, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("failed to check workspace owners: %w", err)
+	}
+
+	return owned, nil
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type calendarObjectRepository struct {
+	db *sql.DB
+}
+
+func NewCalendarObjectRepository(db *sql.DB) CalendarObjectRepository {
+	return &calendarObjectRepository{db: db}
+}
+
+// Set names the calendar object of a note, replacing its previous name.
+func (r *calendarObjectRepository) Set(ctx context.Context, object *models.CalendarObject) error {
+	query := `INSERT INTO calendar_objects (note_id, name, uid) VALUES (?, ?, ?)
+			  ON CONFLICT (note_id) DO UPDATE SET name = excluded.name, uid = excluded.uid`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, object.NoteID, object.Name, object.UID); err != nil {
+		return fmt.Errorf("failed to set calendar object: %w", err)
+	}
+
+	return nil
+}
+
+// GetByName returns the calendar object of a workspace with the given name.
+func (r *calendarObjectRepository) GetByName(ctx context.Context, workspaceID, name string) (*models.CalendarObject, error) {
+	query := `SELECT co.note_id, co.name, co.uid FROM calendar_objects co
+			  JOIN notes n ON n.id = co.note_id
+			  JOIN note_blocks nb ON nb.id = n.note_block_id
+			  WHERE nb.workspace_id = ? AND co.name = ?`
+
+	object := &models.CalendarObject{}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, workspaceID, name).Scan(&object.NoteID, &object.Name, &object.UID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("calendar object not found")
+		}
+		return nil, fmt.Errorf("failed to get calendar object: %w", err)
+	}
+
+	return object, nil
+}
+
+// GetByWorkspaceID returns the named calendar objects of a workspace by note.
+func (r *calendarObjectRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) (map[int64]models.CalendarObject, error) {
+	query := `SELECT co.note_id, co.name, co.uid FROM calendar_objects co
+			  JOIN notes n ON n.id = co.note_id
+			  JOIN note_blocks nb ON nb.id = n.note_block_id
+			  WHERE nb.workspace_id = ?`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar objects: %w", err)
+	}
+	defer rows.Close()
+
+	objects := map[int64]models.CalendarObject{}
+	for rows.Next() {
+		var object models.CalendarObject
+		if err := rows.Scan(&object.NoteID, &object.Name, &object.UID); err != nil {
+			return nil, fmt.Errorf("failed to scan calendar object: %w", err)
+		}
+		objects[object.NoteID] = object
+	}
+
+	return objects, nil
+}
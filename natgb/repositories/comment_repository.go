@@ -0,0 +1,261 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type commentRepository struct {
+	db *sql.DB
+}
+
+func NewCommentRepository(db *sql.DB) CommentRepository {
+	return &commentRepository{db: db}
+}
+
+// commentColumns lists the columns scanComment expects, in order.
+const commentColumns = `id, note_id, parent_id, author_id, author_name, body, created, edited, deleted`
+
+// Create adds a comment by the user in AuthorID, who is named after their
+// current name. Replies must answer a comment of the same note that is not
+// deleted.
+func (r *commentRepository) Create(ctx context.Context, comment *models.Comment) error {
+	comment.Created = time.Now()
+	comment.Edited = nil
+	comment.Deleted = nil
+
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		if comment.ParentID != nil {
+			query := `SELECT EXISTS (SELECT 1 FROM comments WHERE id = ? AND note_id = ? AND deleted IS NULL)`
+
+			var exists bool
+			if err := conn(ctx, r.db).QueryRowContext(ctx, query, *comment.ParentID, comment.NoteID).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to get parent comment: %w", err)
+			}
+			if !exists {
+				return fmt.Errorf("parent comment not found")
+			}
+		}
+
+		query := `INSERT INTO comments (note_id, parent_id, author_id, author_name, body, created)
+				  VALUES (?, ?, ?, COALESCE((SELECT name FROM users WHERE id = ?), ''), ?, ?) RETURNING author_name, id`
+
+		err := conn(ctx, r.db).QueryRowContext(ctx, query,
+			comment.NoteID, comment.ParentID, comment.AuthorID, comment.AuthorID, comment.Body, comment.Created).Scan(&comment.AuthorName, &comment.ID)
+
+		if err != nil {
+			return fmt.Errorf("failed to create comment: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *commentRepository) GetByID(ctx context.Context, id int64) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = ?`
+
+	comment, err := scanComment(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("comment not found")
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// GetByNoteID returns the comment threads of a note, oldest first.
+func (r *commentRepository) GetByNoteID(ctx context.Context, noteID int64) ([]models.Comment, error) {
+	return getCommentThreads(ctx, conn(ctx, r.db), noteID)
+}
+
+// Update replaces the body of a comment that is not deleted.
+func (r *commentRepository) Update(ctx context.Context, comment *models.Comment) error {
+	edited := time.Now()
+	comment.Edited = &edited
+
+	query := `UPDATE comments SET body = ?, edited = ? WHERE id = ? AND deleted IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, comment.Body, edited, comment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("comment not found")
+	}
+
+	return nil
+}
+
+// Delete marks a comment as deleted. Its replies stay in the thread.
+func (r *commentRepository) Delete(ctx context.Context, id int64) error {
+	query := `UPDATE comments SET deleted = ? WHERE id = ? AND deleted IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("comment not found")
+	}
+
+	return nil
+}
+
+// getCommentThreads returns the comments of a note that answer no other
+// comment, with their replies nested.
+func getCommentThreads(ctx context.Context, db dbtx, noteID int64) ([]models.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE note_id = ? ORDER BY created ASC, id ASC`
+
+	rows, err := db.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+	defer rows.Close()
+
+	replies := map[int64][]models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+
+		var parentID int64
+		if comment.ParentID != nil {
+			parentID = *comment.ParentID
+		}
+		replies[parentID] = append(replies[parentID], *comment)
+	}
+
+	var nest func(parentID int64) []models.Comment
+	nest = func(parentID int64) []models.Comment {
+		comments := replies[parentID]
+		for i := range comments {
+			comments[i].Replies = nest(comments[i].ID)
+		}
+		return comments
+	}
+
+	threads := nest(0)
+	if threads == nil {
+		threads = []models.Comment{}
+	}
+	return threads, nil
+}
+
+// insertComments adds comment threads to a note under new IDs, keeping their
+// authors' names and timestamps. Imported comments cannot speak for other
+// users, so only the importer's own comments keep their author; the others
+// keep just the author's name.
+func insertComments(ctx context.Context, db dbtx, noteID int64, parentID *int64, importerID string, comments []models.Comment) error {
+	query := `INSERT INTO comments (note_id, parent_id, author_id, author_name, body, created, edited, deleted)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	for _, comment := range comments {
+		if comment.Created.IsZero() {
+			comment.Created = time.Now()
+		}
+
+		var authorID *string
+		if importerID != "" && comment.AuthorID != nil && *comment.AuthorID == importerID {
+			authorID = &importerID
+		}
+
+		var id int64
+		err := db.QueryRowContext(ctx, query, noteID, parentID, authorID, comment.AuthorName, comment.Body,
+			comment.Created, comment.Edited, comment.Deleted).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to create comment: %w", err)
+		}
+
+		if err := insertComments(ctx, db, noteID, &id, importerID, comment.Replies); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attachCommentCounts fills in the number of comments on each note that are
+// not deleted.
+func attachCommentCounts(ctx context.Context, db dbtx, notes []models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]*models.Note, len(notes))
+	ids := make([]interface{}, len(notes))
+	for i := range notes {
+		index[notes[i].ID] = &notes[i]
+		ids[i] = notes[i].ID
+	}
+
+	query := `SELECT note_id, COUNT(*) FROM comments
+			  WHERE deleted IS NULL AND note_id IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)
+			  GROUP BY note_id`
+
+	rows, err := db.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to count comments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID int64
+		var count int
+		if err := rows.Scan(&noteID, &count); err != nil {
+			return fmt.Errorf("failed to scan comment count: %w", err)
+		}
+		index[noteID].CommentCount = count
+	}
+
+	return nil
+}
+
+// scanComment reads a comment. Deleted comments lose their body.
+func scanComment(row rowScanner) (*models.Comment, error) {
+	comment := &models.Comment{}
+	var parentID sql.NullInt64
+	var authorID sql.NullString
+	var edited, deleted sql.NullTime
+
+	err := row.Scan(&comment.ID, &comment.NoteID, &parentID, &authorID, &comment.AuthorName, &comment.Body,
+		&comment.Created, &edited, &deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = &parentID.Int64
+	}
+	if authorID.Valid {
+		comment.AuthorID = &authorID.String
+	}
+	if edited.Valid {
+		comment.Edited = &edited.Time
+	}
+	if deleted.Valid {
+		comment.Deleted = &deleted.Time
+		comment.Body = ""
+	}
+
+	return comment, nil
+}
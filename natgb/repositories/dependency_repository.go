@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type dependencyRepository struct {
+	db *sql.DB
+}
+
+func NewDependencyRepository(db *sql.DB) DependencyRepository {
+	return &dependencyRepository{db: db}
+}
+
+// Add records that a note is blocked by another one. Links that would close
+// a cycle are rejected.
+func (r *dependencyRepository) Add(ctx context.Context, noteID, dependsOnID int64) error {
+	if noteID == dependsOnID {
+		return fmt.Errorf("dependency cycle: a note cannot depend on itself")
+	}
+
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		cycle, err := closesCycle(ctx, conn(ctx, r.db), noteID, dependsOnID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("dependency cycle: note %d already depends on note %d", dependsOnID, noteID)
+		}
+
+		query := `INSERT INTO note_dependencies (note_id, depends_on_id, created) VALUES (?, ?, ?)`
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, noteID, dependsOnID, time.Now()); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				return fmt.Errorf("dependency already exists")
+			}
+			return fmt.Errorf("failed to add dependency: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// closesCycle reports whether a link would close a cycle, which it does if
+// the note is already upstream of its new dependency.
+func closesCycle(ctx context.Context, db dbtx, noteID, dependsOnID int64) (bool, error) {
+	query := `WITH RECURSIVE upstream(id) AS (
+				SELECT depends_on_id FROM note_dependencies WHERE note_id = ?
+				UNION
+				SELECT d.depends_on_id FROM note_dependencies d JOIN upstream u ON d.note_id = u.id
+			  )
+			  SELECT EXISTS (SELECT 1 FROM upstream WHERE id = ?)`
+
+	var cycle bool
+	if err := db.QueryRowContext(ctx, query, dependsOnID, noteID).Scan(&cycle); err != nil {
+		return false, fmt.Errorf("failed to check dependency cycle: %w", err)
+	}
+	return cycle, nil
+}
+
+// restoreDependency relinks a restored note. Links to notes that are gone,
+// or that would now close a cycle, are left out.
+func restoreDependency(ctx context.Context, db dbtx, noteID, dependsOnID int64) error {
+	cycle, err := closesCycle(ctx, db, noteID, dependsOnID)
+	if err != nil || cycle {
+		return err
+	}
+
+	query := `INSERT OR IGNORE INTO note_dependencies (note_id, depends_on_id, created)
+			  SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM notes WHERE id = ?) AND EXISTS (SELECT 1 FROM notes WHERE id = ?)`
+	if _, err := db.ExecContext(ctx, query, noteID, dependsOnID, time.Now(), noteID, dependsOnID); err != nil {
+		return fmt.Errorf("failed to restore dependency: %w", err)
+	}
+	return nil
+}
+
+func (r *dependencyRepository) Remove(ctx context.Context, noteID, dependsOnID int64) error {
+	query := `DELETE FROM note_dependencies WHERE note_id = ? AND depends_on_id = ?`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, noteID, dependsOnID)
+	if err != nil {
+		return fmt.Errorf("failed to remove dependency: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("dependency not found")
+	}
+
+	return nil
+}
+
+// GetBlockers returns the notes a note depends on.
+func (r *dependencyRepository) GetBlockers(ctx context.Context, noteID int64) ([]models.Note, error) {
+	query := `SELECT ` + qualifiedNoteColumns + ` FROM notes n
+			  JOIN note_dependencies d ON d.depends_on_id = n.id WHERE d.note_id = ? ORDER BY n.id ASC`
+
+	return r.getNotes(ctx, query, noteID)
+}
+
+// GetBlocked returns the notes that depend on a note.
+func (r *dependencyRepository) GetBlocked(ctx context.Context, noteID int64) ([]models.Note, error) {
+	query := `SELECT ` + qualifiedNoteColumns + ` FROM notes n
+			  JOIN note_dependencies d ON d.note_id = n.id WHERE d.depends_on_id = ? ORDER BY n.id ASC`
+
+	return r.getNotes(ctx, query, noteID)
+}
+
+func (r *dependencyRepository) getNotes(ctx context.Context, query string, args ...interface{}) ([]models.Note, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := []models.Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+		notes = append(notes, *note)
+	}
+	rows.Close()
+
+	if err := attachNoteDetails(ctx, conn(ctx, r.db), notes); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// attachDependencies fills in the IDs of the notes each note is blocked by
+// and blocks.
+func attachDependencies(ctx context.Context, db dbtx, notes []models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]*models.Note, len(notes))
+	ids := make([]interface{}, len(notes))
+	for i := range notes {
+		index[notes[i].ID] = &notes[i]
+		ids[i] = notes[i].ID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query := `SELECT note_id, depends_on_id FROM note_dependencies
+			  WHERE note_id IN (` + placeholders + `) OR depends_on_id IN (` + placeholders + `)
+			  ORDER BY note_id ASC, depends_on_id ASC`
+
+	rows, err := db.QueryContext(ctx, query, append(ids, ids...)...)
+	if err != nil {
+		return fmt.Errorf("failed to get note dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID, dependsOnID int64
+		if err := rows.Scan(&noteID, &dependsOnID); err != nil {
+			return fmt.Errorf("failed to scan note dependency: %w", err)
+		}
+		if note, ok := index[noteID]; ok {
+			note.BlockedBy = append(note.BlockedBy, dependsOnID)
+		}
+		if note, ok := index[dependsOnID]; ok {
+			note.Blocks = append(note.Blocks, noteID)
+		}
+	}
+
+	return nil
+}
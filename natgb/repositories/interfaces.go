@@ -2,19 +2,26 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/tanjeetsarkar/nat/models"
 )
 
 type WorkspaceRepository interface {
-	Create(ctx context.Context, workspace *models.Workspace) error
+	Create(ctx context.Context, workspace *models.Workspace, ownerID string) error
 	GetByID(ctx context.Context, id string) (*models.Workspace, error)
 	GetAll(ctx context.Context) ([]models.Workspace, error)
+	GetByUserID(ctx context.Context, userID string) ([]models.Workspace, error)
 	Update(ctx context.Context, workspace *models.Workspace) error
 	Delete(ctx context.Context, id string) error
 	GetWithFullHierarchy(ctx context.Context, id string) (*models.Workspace, error)
-	ImportWorkspaces(ctx context.Context, workspaces []models.Workspace) error
+	ImportWorkspaces(ctx context.Context, workspaces []models.Workspace, ownerID string) error
+	AddNoteBlocks(ctx context.Context, workspaceID string, noteBlocks []models.NoteBlock) error
+	AddNotes(ctx context.Context, workspaceID string, noteBlocks []models.NoteBlock) error
+	RestoreNoteBlock(ctx context.Context, workspaceID string, noteBlock *models.NoteBlock) error
 	ExportAll(ctx context.Context) (*models.ExportData, error)
+	ExportForUser(ctx context.Context, userID string) (*models.ExportData, error)
+	Duplicate(ctx context.Context, id, newID, name, ownerID string, resetCompletion bool) (*models.Workspace, error)
 }
 
 type NoteBlockRepository interface {
@@ -24,6 +31,8 @@ type NoteBlockRepository interface {
 	Update(ctx context.Context, noteBlock *models.NoteBlock) error
 	Delete(ctx context.Context, id int64) error
 	GetWithNotes(ctx context.Context, id int64) (*models.NoteBlock, error)
+	GetWorkspaceID(ctx context.Context, id int64) (string, error)
+	Duplicate(ctx context.Context, id int64, workspaceID, head string, resetCompletion bool) (*models.NoteBlock, error)
 }
 
 type NoteRepository interface {
@@ -32,15 +41,155 @@ type NoteRepository interface {
 	GetByNoteBlockID(ctx context.Context, noteBlockID int64) ([]models.Note, error)
 	Update(ctx context.Context, note *models.Note) error
 	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, note *models.Note, noteBlockID int64) error
 	ToggleCompleted(ctx context.Context, id int64) error
-	GetByPriority(ctx context.Context, noteBlockID int64, priority string) ([]models.Note, error)
-	GetCompleted(ctx context.Context, noteBlockID int64) ([]models.Note, error)
-	GetPending(ctx context.Context, noteBlockID int64) ([]models.Note, error)
+	List(ctx context.Context, filter models.NoteFilter) (*models.NotePage, error)
+	GetWorkspaceID(ctx context.Context, id int64) (string, error)
+}
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User, token *models.APIToken) error
+	GetByID(ctx context.Context, id string) (*models.User, error)
+}
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *models.APIToken) error
+	GetByID(ctx context.Context, id int64) (*models.APIToken, error)
+	GetByUserID(ctx context.Context, userID string) ([]models.APIToken, error)
+	Rename(ctx context.Context, id int64, name string) error
+	Revoke(ctx context.Context, id int64) error
+	Authenticate(ctx context.Context, token string) (*models.APIToken, error)
+}
+
+type MemberRepository interface {
+	Add(ctx context.Context, member *models.WorkspaceMember) error
+	Get(ctx context.Context, workspaceID, userID string) (*models.WorkspaceMember, error)
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.WorkspaceMember, error)
+	UpdateRole(ctx context.Context, workspaceID, userID, role string) error
+	Remove(ctx context.Context, workspaceID, userID string) error
+	CountOwners(ctx context.Context, workspaceID string) (int, error)
+	AssignOrphaned(ctx context.Context, userID string) (int64, error)
+}
+
+type ShareRepository interface {
+	Create(ctx context.Context, link *models.ShareLink) error
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.ShareLink, error)
+	Revoke(ctx context.Context, workspaceID string, id int64) error
+	Resolve(ctx context.Context, token string) (*models.ShareLink, error)
+}
+
+type AuditRepository interface {
+	Append(ctx context.Context, entry *models.AuditEntry) error
+	List(ctx context.Context, filter models.AuditFilter) (*models.AuditPage, error)
+	OwnedAtDeletion(ctx context.Context, workspaceID, userID string) (bool, error)
+}
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	GetByID(ctx context.Context, id int64) (*models.Webhook, error)
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.Webhook, error)
+	GetSubscribed(ctx context.Context, workspaceID, event string) ([]models.Webhook, error)
+	Update(ctx context.Context, webhook *models.Webhook) error
+	Delete(ctx context.Context, id int64) error
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]models.WebhookDelivery, error)
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+type OperationRepository interface {
+	Record(ctx context.Context, op *models.Operation) error
+	GetByWorkspaceID(ctx context.Context, workspaceID string, limit int) ([]models.Operation, error)
+	NextUndo(ctx context.Context, workspaceID string) (*models.Operation, error)
+	NextRedo(ctx context.Context, workspaceID string) (*models.Operation, error)
+	SetUndone(ctx context.Context, id int64, undone bool) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type TemplateRepository interface {
+	Create(ctx context.Context, template *models.WorkspaceTemplate) error
+	GetByID(ctx context.Context, id int64) (*models.WorkspaceTemplate, error)
+	GetByUserID(ctx context.Context, userID string) ([]models.WorkspaceTemplate, error)
+	Delete(ctx context.Context, userID string, id int64) error
+}
+
+type StatsRepository interface {
+	GetWorkspaceStats(ctx context.Context, workspaceID string, since, until time.Time) (*models.WorkspaceStats, error)
+}
+
+type NoteEventRepository interface {
+	GetByNoteID(ctx context.Context, noteID int64) ([]models.NoteEvent, error)
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NoteEvent, error)
+}
+
+type StatusRepository interface {
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NoteStatus, error)
+	Replace(ctx context.Context, workspaceID string, statuses []models.NoteStatus) error
+}
+
+type PriorityRepository interface {
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NotePriority, error)
+	Replace(ctx context.Context, workspaceID string, priorities []models.NotePriority) error
+}
+
+type SavedViewRepository interface {
+	Create(ctx context.Context, view *models.SavedView) error
+	GetByID(ctx context.Context, id int64) (*models.SavedView, error)
+	GetVisible(ctx context.Context, userID string, workspaceIDs []string) ([]models.SavedView, error)
+	Update(ctx context.Context, view *models.SavedView) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type DependencyRepository interface {
+	Add(ctx context.Context, noteID, dependsOnID int64) error
+	Remove(ctx context.Context, noteID, dependsOnID int64) error
+	GetBlockers(ctx context.Context, noteID int64) ([]models.Note, error)
+	GetBlocked(ctx context.Context, noteID int64) ([]models.Note, error)
+}
+
+type CommentRepository interface {
+	Create(ctx context.Context, comment *models.Comment) error
+	GetByID(ctx context.Context, id int64) (*models.Comment, error)
+	GetByNoteID(ctx context.Context, noteID int64) ([]models.Comment, error)
+	Update(ctx context.Context, comment *models.Comment) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type CalendarObjectRepository interface {
+	Set(ctx context.Context, object *models.CalendarObject) error
+	GetByName(ctx context.Context, workspaceID, name string) (*models.CalendarObject, error)
+	GetByWorkspaceID(ctx context.Context, workspaceID string) (map[int64]models.CalendarObject, error)
+}
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *models.Attachment) error
+	GetByID(ctx context.Context, id int64) (*models.Attachment, error)
+	GetByNoteID(ctx context.Context, noteID int64) ([]models.Attachment, error)
+	Delete(ctx context.Context, id int64) error
+	GetOrphanedBlobs(ctx context.Context) ([]string, error)
+	ForgetOrphanedBlob(ctx context.Context, key string) error
 }
 
 // Repository container
 type Repositories struct {
-	Workspace WorkspaceRepository
-	NoteBlock NoteBlockRepository
-	Note      NoteRepository
+	Workspace      WorkspaceRepository
+	NoteBlock      NoteBlockRepository
+	Note           NoteRepository
+	User           UserRepository
+	Token          TokenRepository
+	Member         MemberRepository
+	Share          ShareRepository
+	Audit          AuditRepository
+	Webhook        WebhookRepository
+	Operation      OperationRepository
+	Template       TemplateRepository
+	Stats          StatsRepository
+	NoteEvent      NoteEventRepository
+	Status         StatusRepository
+	Priority       PriorityRepository
+	SavedView      SavedViewRepository
+	Dependency     DependencyRepository
+	Comment        CommentRepository
+	Attachment     AttachmentRepository
+	CalendarObject CalendarObjectRepository
 }
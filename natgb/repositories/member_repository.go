@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type memberRepository struct {
+	db *sql.DB
+}
+
+func NewMemberRepository(db *sql.DB) MemberRepository {
+	return &memberRepository{db: db}
+}
+
+func (r *memberRepository) Add(ctx context.Context, member *models.WorkspaceMember) error {
+	return insertMember(ctx, conn(ctx, r.db), member)
+}
+
+// insertMember adds a membership with whatever transaction db is, so that
+// new workspaces are created together with their owner.
+func insertMember(ctx context.Context, db dbtx, member *models.WorkspaceMember) error {
+	member.Created = time.Now()
+
+	query := `INSERT INTO workspace_members (workspace_id, user_id, role, created) VALUES (?, ?, ?, ?)`
+
+	_, err := db.ExecContext(ctx, query, member.WorkspaceID, member.UserID, member.Role, member.Created)
+	if err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	return nil
+}
+
+func (r *memberRepository) Get(ctx context.Context, workspaceID, userID string) (*models.WorkspaceMember, error) {
+	query := `SELECT workspace_id, user_id, role, created
+			  FROM workspace_members WHERE workspace_id = ? AND user_id = ?`
+
+	member := &models.WorkspaceMember{}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, workspaceID, userID).Scan(
+		&member.WorkspaceID, &member.UserID, &member.Role, &member.Created,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("member not found")
+		}
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	return member, nil
+}
+
+func (r *memberRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.WorkspaceMember, error) {
+	query := `SELECT workspace_id, user_id, role, created
+			  FROM workspace_members WHERE workspace_id = ? ORDER BY created ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.WorkspaceMember
+	for rows.Next() {
+		var member models.WorkspaceMember
+		err := rows.Scan(&member.WorkspaceID, &member.UserID, &member.Role, &member.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func (r *memberRepository) UpdateRole(ctx context.Context, workspaceID, userID, role string) error {
+	query := `UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, role, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("member not found")
+	}
+
+	return nil
+}
+
+func (r *memberRepository) Remove(ctx context.Context, workspaceID, userID string) error {
+	query := `DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("member not found")
+	}
+
+	return nil
+}
+
+func (r *memberRepository) CountOwners(ctx context.Context, workspaceID string) (int, error) {
+	query := `SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND role = 'owner'`
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, workspaceID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count owners: %w", err)
+	}
+
+	return count, nil
+}
+
+// AssignOrphaned makes a user the owner of every workspace without members,
+// which are the workspaces created before memberships existed, and returns
+// how many there were.
+func (r *memberRepository) AssignOrphaned(ctx context.Context, userID string) (int64, error) {
+	query := `INSERT INTO workspace_members (workspace_id, user_id, role, created)
+			  SELECT w.id, ?, 'owner', ? FROM workspaces w
+			  WHERE NOT EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = w.id)`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign workspaces: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type noteEventRepository struct {
+	db *sql.DB
+}
+
+func NewNoteEventRepository(db *sql.DB) NoteEventRepository {
+	return &noteEventRepository{db: db}
+}
+
+// GetByNoteID returns the history of a note, oldest first. Note IDs can be
+// reused after a deletion, so only events since the latest creation count.
+func (r *noteEventRepository) GetByNoteID(ctx context.Context, noteID int64) ([]models.NoteEvent, error) {
+	query := `SELECT id, workspace_id, note_block_id, note_id, event, timestamp
+			  FROM note_events WHERE note_id = ?`
+
+	events, err := r.getEventsByCondition(ctx, query, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Event == models.NoteEventCreated {
+			return events[i:], nil
+		}
+	}
+	return events, nil
+}
+
+// GetByWorkspaceID returns the history of every note of a workspace, oldest
+// first.
+func (r *noteEventRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NoteEvent, error) {
+	query := `SELECT id, workspace_id, note_block_id, note_id, event, timestamp
+			  FROM note_events WHERE workspace_id = ?`
+
+	return r.getEventsByCondition(ctx, query, workspaceID)
+}
+
+func (r *noteEventRepository) getEventsByCondition(ctx context.Context, query string, args ...interface{}) ([]models.NoteEvent, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.NoteEvent{}
+	for rows.Next() {
+		var event models.NoteEvent
+
+		err := rows.Scan(
+			&event.ID, &event.WorkspaceID, &event.NoteBlockID, &event.NoteID, &event.Event, &event.Timestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan note event: %w", err)
+		}
+
+		events = append(events, event)
+	}
+
+	// Timestamps come from both Go and SQLite and differ in format, so they
+	// are ordered after parsing rather than as text
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Timestamp.Equal(events[j].Timestamp) {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	return events, nil
+}
@@ -0,0 +1,290 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+const (
+	defaultNoteLimit = 50
+	maxNoteLimit     = 200
+)
+
+// noteSortColumns maps sort fields to the expressions notes are ordered by.
+// They yield integers or text, so that their values can be carried in
+// cursors. Priorities and statuses unknown to the workspace sort last.
+var noteSortColumns = map[string]string{
+	"id":          "n.id",
+	"head":        "lower(n.head)",
+	"priority":    "COALESCE((SELECT p.rank FROM workspace_priorities p WHERE p.workspace_id = nb.workspace_id AND p.name = n.priority), 2147483647)",
+	"status":      "COALESCE((SELECT s.position FROM workspace_statuses s WHERE s.workspace_id = nb.workspace_id AND s.key = n.status), 2147483647)",
+	"created":     "CAST(n.metadata_created AS TEXT)",
+	"updated":     "CAST(n.metadata_updated AS TEXT)",
+	"completedAt": "COALESCE(CAST(n.metadata_completed_at AS TEXT), '')",
+	"due":         "COALESCE(CAST(n.metadata_due AS TEXT), '')",
+	"noteBlock":   "n.note_block_id",
+}
+
+// qualifiedNoteColumns are the noteColumns of the notes table aliased as n.
+var qualifiedNoteColumns = "n." + strings.ReplaceAll(noteColumns, ", ", ", n.")
+
+// noteCursor is the position after the last note of a page: the values of
+// its sort keys, the last being its ID, under the sort they belong to.
+type noteCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// List returns a page of the notes matching the filter, in the filter's
+// order with the note ID breaking ties. Pages continue after the cursor of
+// the previous one, so notes added or removed meanwhile do not shift them.
+func (r *noteRepository) List(ctx context.Context, filter models.NoteFilter) (*models.NotePage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultNoteLimit
+	}
+	if filter.Limit > maxNoteLimit {
+		filter.Limit = maxNoteLimit
+	}
+
+	page := &models.NotePage{Notes: []models.ListedNote{}}
+	if len(filter.WorkspaceIDs) == 0 {
+		return page, nil
+	}
+
+	var keys, order, signature []string
+	for _, sort := range filter.Sort {
+		column, ok := noteSortColumns[sort.Field]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort field %q", sort.Field)
+		}
+		keys = append(keys, column)
+		if sort.Desc {
+			order = append(order, column+" DESC")
+			signature = append(signature, "-"+sort.Field)
+		} else {
+			order = append(order, column+" ASC")
+			signature = append(signature, sort.Field)
+		}
+	}
+	keys = append(keys, "n.id")
+	order = append(order, "n.id ASC")
+
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	addList := func(format string, values []string) {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		addCondition(fmt.Sprintf(format, placeholders), list...)
+	}
+	// Timestamps are stored as text in local time, so compare in local time
+	addTime := func(condition string, value *time.Time) {
+		if value != nil {
+			addCondition(condition, value.Local())
+		}
+	}
+
+	addList("nb.workspace_id IN (%s)", filter.WorkspaceIDs)
+	if filter.NoteBlockID != 0 {
+		addCondition("n.note_block_id = ?", filter.NoteBlockID)
+	}
+	if len(filter.Priorities) > 0 {
+		addList("n.priority IN (%s)", filter.Priorities)
+	}
+	if len(filter.Statuses) > 0 {
+		addList("n.status IN (%s)", filter.Statuses)
+	}
+	if len(filter.Tags) > 0 {
+		tags := make([]string, len(filter.Tags))
+		for i, tag := range filter.Tags {
+			tags[i] = strings.ToLower(tag)
+		}
+		addList("EXISTS (SELECT 1 FROM json_each(n.tags) t WHERE lower(t.value) IN (%s))", tags)
+	}
+	if filter.Completed != nil {
+		addCondition("n.metadata_completed = ?", *filter.Completed)
+	}
+	if filter.Ready != nil {
+		// Ready notes are pending with no pending dependency
+		blocked := `EXISTS (SELECT 1 FROM note_dependencies d JOIN notes b ON b.id = d.depends_on_id
+					WHERE d.note_id = n.id AND NOT b.metadata_completed)`
+		if *filter.Ready {
+			addCondition("n.metadata_completed = false AND NOT " + blocked)
+		} else {
+			addCondition("n.metadata_completed = false AND " + blocked)
+		}
+	}
+	if filter.Text != "" {
+		pattern := "%" + escapeLike(filter.Text) + "%"
+		addCondition(`(n.head LIKE ? ESCAPE '\' OR n.note LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	addTime("n.metadata_created >= ?", filter.CreatedAfter)
+	addTime("n.metadata_created < ?", filter.CreatedBefore)
+	addTime("n.metadata_updated >= ?", filter.UpdatedAfter)
+	addTime("n.metadata_updated < ?", filter.UpdatedBefore)
+	addTime("n.metadata_completed_at >= ?", filter.CompletedAfter)
+	addTime("n.metadata_completed_at < ?", filter.CompletedBefore)
+	addTime("n.metadata_due >= ?", filter.DueAfter)
+	addTime("n.metadata_due < ?", filter.DueBefore)
+
+	from := ` FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id JOIN workspaces w ON w.id = nb.workspace_id
+			  WHERE `
+
+	countQuery := `SELECT COUNT(*)` + from + strings.Join(conditions, " AND ")
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count notes: %w", err)
+	}
+
+	if filter.Cursor != "" {
+		values, err := decodeNoteCursor(filter.Cursor, strings.Join(signature, ","), len(keys))
+		if err != nil {
+			return nil, err
+		}
+
+		// Rows after the cursor: equal on the leading keys and past it on the next
+		var after []string
+		for i := range keys {
+			var parts []string
+			for j := 0; j < i; j++ {
+				parts = append(parts, keys[j]+" = ?")
+				args = append(args, values[j])
+			}
+			op := ">"
+			if i < len(filter.Sort) && filter.Sort[i].Desc {
+				op = "<"
+			}
+			parts = append(parts, keys[i]+" "+op+" ?")
+			args = append(args, values[i])
+			after = append(after, "("+strings.Join(parts, " AND ")+")")
+		}
+		conditions = append(conditions, "("+strings.Join(after, " OR ")+")")
+	}
+
+	query := `SELECT ` + qualifiedNoteColumns + `, nb.head, w.id, w.name, ` + strings.Join(keys, ", ") +
+		from + strings.Join(conditions, " AND ") + ` ORDER BY ` + strings.Join(order, ", ") + ` LIMIT ?`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	defer rows.Close()
+
+	var last []interface{}
+	for rows.Next() {
+		var listed models.ListedNote
+		values := make([]interface{}, len(keys))
+		extra := []interface{}{&listed.NoteBlockHead, &listed.WorkspaceID, &listed.WorkspaceName}
+		for i := range values {
+			extra = append(extra, &values[i])
+		}
+
+		note, err := scanNote(extraScanner{rows, extra})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+
+		if len(page.Notes) == filter.Limit {
+			page.NextCursor, err = encodeNoteCursor(strings.Join(signature, ","), last)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		listed.Note = *note
+		listed.NoteBlockID = note.NoteBlockID
+		page.Notes = append(page.Notes, listed)
+		last = values
+	}
+	rows.Close()
+
+	notes := make([]models.Note, len(page.Notes))
+	for i := range page.Notes {
+		notes[i] = page.Notes[i].Note
+	}
+	if err := attachNoteDetails(ctx, conn(ctx, r.db), notes); err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		page.Notes[i].Note = notes[i]
+	}
+
+	return page, nil
+}
+
+// extraScanner scans the columns following those of a row scanner into
+// extra destinations.
+type extraScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+func encodeNoteCursor(sort string, values []interface{}) (string, error) {
+	for i, value := range values {
+		if b, ok := value.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	data, err := json.Marshal(noteCursor{Sort: sort, Values: values})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeNoteCursor returns the key values of a cursor. Cursors only continue
+// listings with the sort they were created for.
+func decodeNoteCursor(cursor, sort string, keys int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var decoded noteCursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil || decoded.Sort != sort || len(decoded.Values) != keys {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	for i, value := range decoded.Values {
+		switch value := value.(type) {
+		case json.Number:
+			n, err := value.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid cursor")
+			}
+			decoded.Values[i] = n
+		case string:
+		default:
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return decoded.Values, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, using \ as the escape
+// character.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
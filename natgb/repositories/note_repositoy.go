@@ -3,7 +3,9 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/tanjeetsarkar/nat/models"
@@ -34,13 +36,35 @@ func (r *noteRepository) Create(ctx context.Context, note *models.Note, noteBloc
 		note.Metadata.Completed = &completed
 	}
 
-	query := `INSERT INTO notes (id, priority, head, note, metadata_created, metadata_updated, metadata_completed, note_block_id) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	// Completed notes without a completion time were completed by their last update
+	if !*note.Metadata.Completed {
+		note.Metadata.CompletedAt = nil
+	} else if note.Metadata.CompletedAt == nil {
+		completedAt := note.Metadata.Updated
+		note.Metadata.CompletedAt = &completedAt
+	}
+
+	if note.Priority == "" {
+		priority, err := defaultPriority(ctx, conn(ctx, r.db), noteBlockID)
+		if err != nil {
+			return err
+		}
+		note.Priority = priority
+	}
+
+	note.Tags = normalizeTags(note.Tags)
+	tags, err := json.Marshal(note.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to encode note tags: %w", err)
+	}
+
+	query := `INSERT INTO notes (id, priority, status, head, note, tags, metadata_created, metadata_updated, metadata_completed, metadata_completed_at, metadata_due, note_block_id) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
 
 	var returnedID int64
-	err := r.db.QueryRowContext(ctx, query,
-		note.ID, note.Priority, note.Head, note.Note,
-		note.Metadata.Created, note.Metadata.Updated, *note.Metadata.Completed, noteBlockID).Scan(&returnedID)
+	err = conn(ctx, r.db).QueryRowContext(ctx, query,
+		nullableID(note.ID), note.Priority, note.Status, note.Head, note.Note, string(tags),
+		note.Metadata.Created, note.Metadata.Updated, *note.Metadata.Completed, note.Metadata.CompletedAt, note.Metadata.Due, noteBlockID).Scan(&returnedID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create note: %w", err)
@@ -50,22 +74,45 @@ func (r *noteRepository) Create(ctx context.Context, note *models.Note, noteBloc
 	if note.ID == 0 {
 		note.ID = returnedID
 	}
+	note.NoteBlockID = noteBlockID
 
-	return nil
+	return r.syncStatus(ctx, note)
 }
 
-func (r *noteRepository) GetByID(ctx context.Context, id int64) (*models.Note, error) {
-	query := `SELECT id, priority, head, note, metadata_created, metadata_updated, metadata_completed 
-			  FROM notes WHERE id = ?`
+// Restore recreates a deleted note under its own ID, with its dependencies
+// on notes that still exist, all or none.
+func (r *noteRepository) Restore(ctx context.Context, note *models.Note, noteBlockID int64) error {
+	blockedBy, blocks := note.BlockedBy, note.Blocks
 
-	note := &models.Note{}
-	var completed bool
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		if err := r.Create(ctx, note, noteBlockID); err != nil {
+			return err
+		}
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&note.ID, &note.Priority, &note.Head, &note.Note,
-		&note.Metadata.Created, &note.Metadata.Updated, &completed,
-	)
+		for _, dependsOnID := range blockedBy {
+			if err := restoreDependency(ctx, conn(ctx, r.db), note.ID, dependsOnID); err != nil {
+				return err
+			}
+		}
+		for _, blockedID := range blocks {
+			if err := restoreDependency(ctx, conn(ctx, r.db), blockedID, note.ID); err != nil {
+				return err
+			}
+		}
+
+		notes := []models.Note{*note}
+		if err := attachDependencies(ctx, conn(ctx, r.db), notes); err != nil {
+			return err
+		}
+		note.BlockedBy, note.Blocks = notes[0].BlockedBy, notes[0].Blocks
+		return nil
+	})
+}
 
+func (r *noteRepository) GetByID(ctx context.Context, id int64) (*models.Note, error) {
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE id = ?`
+
+	note, err := scanNote(conn(ctx, r.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("note not found")
@@ -73,69 +120,80 @@ func (r *noteRepository) GetByID(ctx context.Context, id int64) (*models.Note, e
 		return nil, fmt.Errorf("failed to get note: %w", err)
 	}
 
-	note.Metadata.Completed = &completed
-	return note, nil
+	notes := []models.Note{*note}
+	if err := attachNoteDetails(ctx, conn(ctx, r.db), notes); err != nil {
+		return nil, err
+	}
+
+	return &notes[0], nil
 }
 
 func (r *noteRepository) GetByNoteBlockID(ctx context.Context, noteBlockID int64) ([]models.Note, error) {
-	query := `SELECT id, priority, head, note, metadata_created, metadata_updated, metadata_completed 
-			  FROM notes WHERE note_block_id = ? ORDER BY id ASC`
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE note_block_id = ? ORDER BY id ASC`
 
-	rows, err := r.db.QueryContext(ctx, query, noteBlockID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get notes: %w", err)
-	}
-	defer rows.Close()
+	return r.getNotesByCondition(ctx, query, noteBlockID)
+}
 
-	var notes []models.Note
-	for rows.Next() {
-		var note models.Note
+func (r *noteRepository) Update(ctx context.Context, note *models.Note) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		var status string
 		var completed bool
-
-		err := rows.Scan(
-			&note.ID, &note.Priority, &note.Head, &note.Note,
-			&note.Metadata.Created, &note.Metadata.Updated, &completed,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan note: %w", err)
+		query := `SELECT status, metadata_completed FROM notes WHERE id = ?`
+		if err := conn(ctx, r.db).QueryRowContext(ctx, query, note.ID).Scan(&status, &completed); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("note not found")
+			}
+			return fmt.Errorf("failed to get note: %w", err)
 		}
 
-		note.Metadata.Completed = &completed
-		notes = append(notes, note)
-	}
+		if note.Metadata.Completed == nil {
+			note.Metadata.Completed = &completed
+		}
+		// Clients unaware of statuses only flip the completed flag, which then
+		// picks the status
+		if note.Status == status && *note.Metadata.Completed != completed {
+			note.Status = ""
+		}
 
-	return notes, nil
-}
+		// Notes sent without tags keep theirs
+		var tags interface{}
+		if note.Tags != nil {
+			note.Tags = normalizeTags(note.Tags)
+			encoded, err := json.Marshal(note.Tags)
+			if err != nil {
+				return fmt.Errorf("failed to encode note tags: %w", err)
+			}
+			tags = string(encoded)
+		}
 
-func (r *noteRepository) Update(ctx context.Context, note *models.Note) error {
-	note.Metadata.Updated = time.Now()
+		note.Metadata.Updated = time.Now()
 
-	query := `UPDATE notes SET priority = ?, head = ?, note = ?, metadata_updated = ?, metadata_completed = ? 
-			  WHERE id = ?`
+		// Keep the completion time while a note stays completed
+		query = `UPDATE notes SET priority = ?, status = ?, head = ?, note = ?, tags = COALESCE(?, tags), metadata_updated = ?, metadata_completed = ?,
+				 metadata_completed_at = CASE WHEN ? THEN COALESCE(?, metadata_completed_at, ?) ELSE NULL END, metadata_due = ?
+				 WHERE id = ? RETURNING tags`
 
-	result, err := r.db.ExecContext(ctx, query,
-		note.Priority, note.Head, note.Note, note.Metadata.Updated, *note.Metadata.Completed, note.ID)
+		var storedTags string
+		err := conn(ctx, r.db).QueryRowContext(ctx, query,
+			note.Priority, note.Status, note.Head, note.Note, tags, note.Metadata.Updated, *note.Metadata.Completed,
+			*note.Metadata.Completed, note.Metadata.CompletedAt, note.Metadata.Updated, note.Metadata.Due, note.ID).Scan(&storedTags)
 
-	if err != nil {
-		return fmt.Errorf("failed to update note: %w", err)
-	}
-
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("failed to update note: %w", err)
+		}
 
-	if affected == 0 {
-		return fmt.Errorf("note not found")
-	}
+		if err := json.Unmarshal([]byte(storedTags), &note.Tags); err != nil {
+			return fmt.Errorf("failed to decode note tags: %w", err)
+		}
 
-	return nil
+		return r.syncStatus(ctx, note)
+	})
 }
 
 func (r *noteRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM notes WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete note: %w", err)
 	}
@@ -153,48 +211,48 @@ func (r *noteRepository) Delete(ctx context.Context, id int64) error {
 }
 
 func (r *noteRepository) ToggleCompleted(ctx context.Context, id int64) error {
-	query := `UPDATE notes SET metadata_completed = NOT metadata_completed, metadata_updated = ? WHERE id = ?`
-
-	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
-	if err != nil {
-		return fmt.Errorf("failed to toggle completed: %w", err)
-	}
-
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
-	}
-
-	if affected == 0 {
-		return fmt.Errorf("note not found")
-	}
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		// Assignments see the old row, so the completion time is set when
+		// completing. The cleared status is picked from the new flag.
+		query := `UPDATE notes SET metadata_completed = NOT metadata_completed, status = '', metadata_updated = ?,
+				  metadata_completed_at = CASE WHEN metadata_completed THEN NULL ELSE ? END WHERE id = ?`
+
+		now := time.Now()
+		result, err := conn(ctx, r.db).ExecContext(ctx, query, now, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to toggle completed: %w", err)
+		}
 
-	return nil
-}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
 
-func (r *noteRepository) GetByPriority(ctx context.Context, noteBlockID int64, priority string) ([]models.Note, error) {
-	query := `SELECT id, priority, head, note, metadata_created, metadata_updated, metadata_completed 
-			  FROM notes WHERE note_block_id = ? AND priority = ? ORDER BY id ASC`
+		if affected == 0 {
+			return fmt.Errorf("note not found")
+		}
 
-	return r.getNotesByCondition(ctx, query, noteBlockID, priority)
+		return syncNoteStatuses(ctx, conn(ctx, r.db), `id = ?`, id)
+	})
 }
 
-func (r *noteRepository) GetCompleted(ctx context.Context, noteBlockID int64) ([]models.Note, error) {
-	query := `SELECT id, priority, head, note, metadata_created, metadata_updated, metadata_completed 
-			  FROM notes WHERE note_block_id = ? AND metadata_completed = true ORDER BY id ASC`
+func (r *noteRepository) GetWorkspaceID(ctx context.Context, id int64) (string, error) {
+	query := `SELECT nb.workspace_id FROM notes n
+			  JOIN note_blocks nb ON nb.id = n.note_block_id WHERE n.id = ?`
 
-	return r.getNotesByCondition(ctx, query, noteBlockID)
-}
-
-func (r *noteRepository) GetPending(ctx context.Context, noteBlockID int64) ([]models.Note, error) {
-	query := `SELECT id, priority, head, note, metadata_created, metadata_updated, metadata_completed 
-			  FROM notes WHERE note_block_id = ? AND metadata_completed = false ORDER BY id ASC`
+	var workspaceID string
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&workspaceID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("note not found")
+		}
+		return "", fmt.Errorf("failed to get note workspace: %w", err)
+	}
 
-	return r.getNotesByCondition(ctx, query, noteBlockID)
+	return workspaceID, nil
 }
 
 func (r *noteRepository) getNotesByCondition(ctx context.Context, query string, args ...interface{}) ([]models.Note, error) {
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notes: %w", err)
 	}
@@ -202,20 +260,100 @@ func (r *noteRepository) getNotesByCondition(ctx context.Context, query string,
 
 	var notes []models.Note
 	for rows.Next() {
-		var note models.Note
-		var completed bool
-
-		err := rows.Scan(
-			&note.ID, &note.Priority, &note.Head, &note.Note,
-			&note.Metadata.Created, &note.Metadata.Updated, &completed,
-		)
+		note, err := scanNote(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
+		notes = append(notes, *note)
+	}
+	rows.Close()
 
-		note.Metadata.Completed = &completed
-		notes = append(notes, note)
+	if err := attachNoteDetails(ctx, conn(ctx, r.db), notes); err != nil {
+		return nil, err
 	}
 
 	return notes, nil
 }
+
+// syncStatus derives the status and completion of a written note, then loads
+// them back into it.
+func (r *noteRepository) syncStatus(ctx context.Context, note *models.Note) error {
+	if err := syncNoteStatuses(ctx, conn(ctx, r.db), `id = ?`, note.ID); err != nil {
+		return err
+	}
+
+	var completed bool
+	var completedAt sql.NullTime
+	query := `SELECT status, metadata_completed, metadata_completed_at FROM notes WHERE id = ?`
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, note.ID).Scan(&note.Status, &completed, &completedAt); err != nil {
+		return fmt.Errorf("failed to get note status: %w", err)
+	}
+
+	note.Metadata.Completed = &completed
+	note.Metadata.CompletedAt = nil
+	if completedAt.Valid {
+		note.Metadata.CompletedAt = &completedAt.Time
+	}
+
+	return nil
+}
+
+// noteColumns lists the columns scanNote expects, in order.
+const noteColumns = `id, priority, status, head, note, tags, metadata_created, metadata_updated, metadata_completed, metadata_completed_at, metadata_due, note_block_id`
+
+func scanNote(row rowScanner) (*models.Note, error) {
+	note := &models.Note{}
+	var tags string
+	var completed bool
+	var completedAt, due sql.NullTime
+
+	err := row.Scan(
+		&note.ID, &note.Priority, &note.Status, &note.Head, &note.Note, &tags,
+		&note.Metadata.Created, &note.Metadata.Updated, &completed, &completedAt, &due, &note.NoteBlockID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags), &note.Tags); err != nil {
+		return nil, fmt.Errorf("failed to decode note tags: %w", err)
+	}
+
+	note.Metadata.Completed = &completed
+	if completedAt.Valid {
+		note.Metadata.CompletedAt = &completedAt.Time
+	}
+	if due.Valid {
+		note.Metadata.Due = &due.Time
+	}
+
+	return note, nil
+}
+
+// attachNoteDetails fills in what notes carry from other tables: their
+// dependencies, comment counts and attachments.
+func attachNoteDetails(ctx context.Context, db dbtx, notes []models.Note) error {
+	if err := attachDependencies(ctx, db, notes); err != nil {
+		return err
+	}
+	if err := attachCommentCounts(ctx, db, notes); err != nil {
+		return err
+	}
+	return attachAttachments(ctx, db, notes)
+}
+
+// normalizeTags trims tags and drops empty and repeated ones, keeping their
+// order.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
@@ -32,8 +32,8 @@ func (r *noteBlockRepository) Create(ctx context.Context, noteBlock *models.Note
 			  VALUES (?, ?, ?, ?, ?) RETURNING id`
 
 	var returnedID int64
-	err := r.db.QueryRowContext(ctx, query,
-		noteBlock.ID, noteBlock.Head, noteBlock.Metadata.Created, noteBlock.Metadata.Updated, workspaceID).Scan(&returnedID)
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		nullableID(noteBlock.ID), noteBlock.Head, noteBlock.Metadata.Created, noteBlock.Metadata.Updated, workspaceID).Scan(&returnedID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create note block: %w", err)
@@ -52,7 +52,7 @@ func (r *noteBlockRepository) GetByID(ctx context.Context, id int64) (*models.No
 			  FROM note_blocks WHERE id = ?`
 
 	noteBlock := &models.NoteBlock{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
 		&noteBlock.ID, &noteBlock.Head, &noteBlock.Metadata.Created, &noteBlock.Metadata.Updated,
 	)
 
@@ -70,7 +70,7 @@ func (r *noteBlockRepository) GetByWorkspaceID(ctx context.Context, workspaceID
 	query := `SELECT id, head, metadata_created, metadata_updated 
 			  FROM note_blocks WHERE workspace_id = ? ORDER BY id ASC`
 
-	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get note blocks: %w", err)
 	}
@@ -96,7 +96,7 @@ func (r *noteBlockRepository) Update(ctx context.Context, noteBlock *models.Note
 
 	query := `UPDATE note_blocks SET head = ?, metadata_updated = ? WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, noteBlock.Head, noteBlock.Metadata.Updated, noteBlock.ID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, noteBlock.Head, noteBlock.Metadata.Updated, noteBlock.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update note block: %w", err)
 	}
@@ -116,7 +116,7 @@ func (r *noteBlockRepository) Update(ctx context.Context, noteBlock *models.Note
 func (r *noteBlockRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM note_blocks WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete note block: %w", err)
 	}
@@ -145,3 +145,66 @@ func (r *noteBlockRepository) GetWithNotes(ctx context.Context, id int64) (*mode
 
 	return noteBlock, nil
 }
+
+func (r *noteBlockRepository) GetWorkspaceID(ctx context.Context, id int64) (string, error) {
+	query := `SELECT workspace_id FROM note_blocks WHERE id = ?`
+
+	var workspaceID string
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&workspaceID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("note block not found")
+		}
+		return "", fmt.Errorf("failed to get note block workspace: %w", err)
+	}
+
+	return workspaceID, nil
+}
+
+// Duplicate copies a note block and its notes under new IDs into a workspace,
+// which may be the block's own, in a single transaction. An empty head keeps
+// the source head; resetCompletion marks every copied note as pending.
+func (r *noteBlockRepository) Duplicate(ctx context.Context, id int64, workspaceID, head string, resetCompletion bool) (*models.NoteBlock, error) {
+	var noteBlock models.NoteBlock
+
+	err := inTx(ctx, r.db, func(ctx context.Context) error {
+		source, err := r.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		noteBlock.Head = head
+		if noteBlock.Head == "" {
+			noteBlock.Head = source.Head
+		}
+		if err := r.Create(ctx, &noteBlock, workspaceID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		query := `INSERT INTO notes (priority, status, head, note, tags, metadata_created, metadata_updated, metadata_completed, metadata_completed_at, metadata_due, note_block_id)
+				  SELECT priority, CASE WHEN ? THEN '' ELSE status END, head, note, tags, ?, ?, CASE WHEN ? THEN false ELSE metadata_completed END,
+				  CASE WHEN ? THEN NULL ELSE metadata_completed_at END, metadata_due, ?
+				  FROM notes WHERE note_block_id = ? ORDER BY id ASC`
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, resetCompletion, now, now, resetCompletion, resetCompletion, noteBlock.ID, id); err != nil {
+			return fmt.Errorf("failed to copy notes: %w", err)
+		}
+
+		// Statuses missing from the target workspace fall back to its defaults
+		return syncNoteStatuses(ctx, conn(ctx, r.db), `note_block_id = ?`, noteBlock.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &noteBlock, nil
+}
+
+// nullableID passes a zero ID as NULL so that SQLite generates one, while
+// explicit IDs (imports, restores) are kept.
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
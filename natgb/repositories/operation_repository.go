@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// maxOperations is how many operations are kept per workspace; older ones
+// can no longer be undone.
+const maxOperations = 100
+
+type operationRepository struct {
+	db *sql.DB
+}
+
+func NewOperationRepository(db *sql.DB) OperationRepository {
+	return &operationRepository{db: db}
+}
+
+// Record appends an operation to the history of its workspace. Undone
+// operations are discarded first, since a new change invalidates the redo
+// stack.
+func (r *operationRepository) Record(ctx context.Context, op *models.Operation) error {
+	if op.Created.IsZero() {
+		op.Created = time.Now()
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM operations WHERE workspace_id = ? AND undone = true`, op.WorkspaceID); err != nil {
+		return fmt.Errorf("failed to clear redo history: %w", err)
+	}
+
+	query := `INSERT INTO operations (workspace_id, entity_type, entity_id, parent_id, action, actor, created, before, after)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query,
+		op.WorkspaceID, op.EntityType, op.EntityID, op.ParentID, op.Action, op.Actor, op.Created,
+		nullableJSON(op.Before), nullableJSON(op.After)).Scan(&op.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record operation: %w", err)
+	}
+
+	prune := `DELETE FROM operations WHERE workspace_id = ? AND id NOT IN (
+				SELECT id FROM operations WHERE workspace_id = ? ORDER BY id DESC LIMIT ?)`
+	if _, err := tx.ExecContext(ctx, prune, op.WorkspaceID, op.WorkspaceID, maxOperations); err != nil {
+		return fmt.Errorf("failed to prune operations: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit operation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByWorkspaceID returns the history of a workspace, newest first.
+func (r *operationRepository) GetByWorkspaceID(ctx context.Context, workspaceID string, limit int) ([]models.Operation, error) {
+	query := `SELECT id, workspace_id, entity_type, entity_id, parent_id, action, actor, created, undone, before, after
+			  FROM operations WHERE workspace_id = ? ORDER BY id DESC LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operations: %w", err)
+	}
+	defer rows.Close()
+
+	operations := []models.Operation{}
+	for rows.Next() {
+		op, err := scanOperation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan operation: %w", err)
+		}
+		operations = append(operations, *op)
+	}
+
+	return operations, nil
+}
+
+// NextUndo returns the most recent operation that has not been undone.
+func (r *operationRepository) NextUndo(ctx context.Context, workspaceID string) (*models.Operation, error) {
+	query := `SELECT id, workspace_id, entity_type, entity_id, parent_id, action, actor, created, undone, before, after
+			  FROM operations WHERE workspace_id = ? AND undone = false ORDER BY id DESC LIMIT 1`
+
+	return r.getOperation(ctx, query, "nothing to undo", workspaceID)
+}
+
+// NextRedo returns the oldest undone operation, which is the one undone last.
+func (r *operationRepository) NextRedo(ctx context.Context, workspaceID string) (*models.Operation, error) {
+	query := `SELECT id, workspace_id, entity_type, entity_id, parent_id, action, actor, created, undone, before, after
+			  FROM operations WHERE workspace_id = ? AND undone = true ORDER BY id ASC LIMIT 1`
+
+	return r.getOperation(ctx, query, "nothing to redo", workspaceID)
+}
+
+func (r *operationRepository) SetUndone(ctx context.Context, id int64, undone bool) error {
+	query := `UPDATE operations SET undone = ? WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, undone, id)
+	if err != nil {
+		return fmt.Errorf("failed to update operation: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("operation not found")
+	}
+
+	return nil
+}
+
+func (r *operationRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM operations WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete operation: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("operation not found")
+	}
+
+	return nil
+}
+
+func (r *operationRepository) getOperation(ctx context.Context, query, notFound string, args ...interface{}) (*models.Operation, error) {
+	op, err := scanOperation(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s", notFound)
+		}
+		return nil, fmt.Errorf("failed to get operation: %w", err)
+	}
+
+	return op, nil
+}
+
+func scanOperation(row rowScanner) (*models.Operation, error) {
+	op := &models.Operation{}
+	var before, after sql.NullString
+
+	err := row.Scan(
+		&op.ID, &op.WorkspaceID, &op.EntityType, &op.EntityID, &op.ParentID,
+		&op.Action, &op.Actor, &op.Created, &op.Undone, &before, &after,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable snapshots
+	if before.Valid {
+		op.Before = []byte(before.String)
+	}
+	if after.Valid {
+		op.After = []byte(after.String)
+	}
+
+	return op, nil
+}
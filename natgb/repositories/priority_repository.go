@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type priorityRepository struct {
+	db *sql.DB
+}
+
+func NewPriorityRepository(db *sql.DB) PriorityRepository {
+	return &priorityRepository{db: db}
+}
+
+func (r *priorityRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NotePriority, error) {
+	query := `SELECT name, rank, color FROM workspace_priorities
+			  WHERE workspace_id = ? ORDER BY rank ASC, name ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get priorities: %w", err)
+	}
+	defer rows.Close()
+
+	priorities := []models.NotePriority{}
+	for rows.Next() {
+		var priority models.NotePriority
+		if err := rows.Scan(&priority.Name, &priority.Rank, &priority.Color); err != nil {
+			return nil, fmt.Errorf("failed to scan priority: %w", err)
+		}
+		priorities = append(priorities, priority)
+	}
+
+	return priorities, nil
+}
+
+// Replace sets the priorities of a workspace. Priorities still used by notes
+// cannot be removed; notes with priorities that predate validation are left
+// alone.
+func (r *priorityRepository) Replace(ctx context.Context, workspaceID string, priorities []models.NotePriority) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		current, err := r.GetByWorkspaceID(ctx, workspaceID)
+		if err != nil {
+			return err
+		}
+
+		names := map[string]bool{}
+		for _, priority := range priorities {
+			names[priority.Name] = true
+		}
+
+		query := `SELECT EXISTS (SELECT 1 FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id
+				  WHERE nb.workspace_id = ? AND n.priority = ?)`
+
+		for _, priority := range current {
+			if names[priority.Name] {
+				continue
+			}
+
+			var used bool
+			if err := conn(ctx, r.db).QueryRowContext(ctx, query, workspaceID, priority.Name).Scan(&used); err != nil {
+				return fmt.Errorf("failed to check priority usage: %w", err)
+			}
+			if used {
+				return fmt.Errorf("priority in use: %s", priority.Name)
+			}
+		}
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM workspace_priorities WHERE workspace_id = ?`, workspaceID); err != nil {
+			return fmt.Errorf("failed to delete priorities: %w", err)
+		}
+
+		return insertPriorities(ctx, conn(ctx, r.db), workspaceID, priorities)
+	})
+}
+
+func insertPriorities(ctx context.Context, db dbtx, workspaceID string, priorities []models.NotePriority) error {
+	query := `INSERT INTO workspace_priorities (workspace_id, name, rank, color) VALUES (?, ?, ?, ?)`
+
+	for _, priority := range priorities {
+		if _, err := db.ExecContext(ctx, query, workspaceID, priority.Name, priority.Rank, priority.Color); err != nil {
+			return fmt.Errorf("failed to create priority: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// defaultPriority returns the priority notes of a note block get when
+// created without one: the middle priority of the workspace by rank.
+func defaultPriority(ctx context.Context, db dbtx, noteBlockID int64) (string, error) {
+	query := `SELECT p.name FROM workspace_priorities p JOIN note_blocks nb ON nb.workspace_id = p.workspace_id
+			  WHERE nb.id = ? ORDER BY p.rank ASC, p.name ASC`
+
+	rows, err := db.QueryContext(ctx, query, noteBlockID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get priorities: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("failed to scan priority: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return "", nil
+	}
+	return names[(len(names)-1)/2], nil
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type savedViewRepository struct {
+	db *sql.DB
+}
+
+func NewSavedViewRepository(db *sql.DB) SavedViewRepository {
+	return &savedViewRepository{db: db}
+}
+
+func (r *savedViewRepository) Create(ctx context.Context, view *models.SavedView) error {
+	now := time.Now()
+	view.Created = now
+	view.Updated = now
+
+	filter, err := json.Marshal(view.Filter)
+	if err != nil {
+		return fmt.Errorf("failed to encode view filter: %w", err)
+	}
+
+	query := `INSERT INTO saved_views (user_id, workspace_id, name, filter, created, updated)
+			  VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err = r.db.QueryRowContext(ctx, query,
+		view.UserID, view.WorkspaceID, view.Name, string(filter), view.Created, view.Updated).Scan(&view.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create view: %w", err)
+	}
+
+	return nil
+}
+
+func (r *savedViewRepository) GetByID(ctx context.Context, id int64) (*models.SavedView, error) {
+	query := `SELECT id, user_id, workspace_id, name, filter, created, updated FROM saved_views WHERE id = ?`
+
+	view, err := scanSavedView(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("view not found")
+		}
+		return nil, fmt.Errorf("failed to get view: %w", err)
+	}
+
+	return view, nil
+}
+
+// GetVisible returns the personal views of a user and the views of the given
+// workspaces, personal views first.
+func (r *savedViewRepository) GetVisible(ctx context.Context, userID string, workspaceIDs []string) ([]models.SavedView, error) {
+	condition := `(user_id = ? AND workspace_id IS NULL)`
+	args := []interface{}{userID}
+	if len(workspaceIDs) > 0 {
+		condition += ` OR workspace_id IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(workspaceIDs)), ", ") + `)`
+		for _, id := range workspaceIDs {
+			args = append(args, id)
+		}
+	}
+
+	query := `SELECT id, user_id, workspace_id, name, filter, created, updated FROM saved_views
+			  WHERE ` + condition + ` ORDER BY workspace_id IS NOT NULL, workspace_id ASC, name ASC, id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get views: %w", err)
+	}
+	defer rows.Close()
+
+	views := []models.SavedView{}
+	for rows.Next() {
+		view, err := scanSavedView(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan view: %w", err)
+		}
+		views = append(views, *view)
+	}
+
+	return views, nil
+}
+
+func (r *savedViewRepository) Update(ctx context.Context, view *models.SavedView) error {
+	view.Updated = time.Now()
+
+	filter, err := json.Marshal(view.Filter)
+	if err != nil {
+		return fmt.Errorf("failed to encode view filter: %w", err)
+	}
+
+	query := `UPDATE saved_views SET name = ?, filter = ?, updated = ? WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, view.Name, string(filter), view.Updated, view.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update view: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("view not found")
+	}
+
+	return nil
+}
+
+func (r *savedViewRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM saved_views WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("view not found")
+	}
+
+	return nil
+}
+
+func scanSavedView(row rowScanner) (*models.SavedView, error) {
+	view := &models.SavedView{}
+	var workspaceID sql.NullString
+	var filter string
+
+	err := row.Scan(&view.ID, &view.UserID, &workspaceID, &view.Name, &filter, &view.Created, &view.Updated)
+	if err != nil {
+		return nil, err
+	}
+
+	if workspaceID.Valid {
+		view.WorkspaceID = &workspaceID.String
+	}
+
+	if err := json.Unmarshal([]byte(filter), &view.Filter); err != nil {
+		return nil, fmt.Errorf("failed to decode view filter: %w", err)
+	}
+
+	return view, nil
+}
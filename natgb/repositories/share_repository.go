@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// sharePrefix marks share link tokens, distinguishing them from API tokens.
+const sharePrefix = "share_"
+
+type shareRepository struct {
+	db *sql.DB
+}
+
+func NewShareRepository(db *sql.DB) ShareRepository {
+	return &shareRepository{db: db}
+}
+
+// Create generates a new secret for the link, stores its hash and sets the
+// plaintext on link.Token so it can be shown to the caller once.
+func (r *shareRepository) Create(ctx context.Context, link *models.ShareLink) error {
+	plaintext, err := generateSecret(sharePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	link.Token = plaintext
+	link.Prefix = link.Token[:len(sharePrefix)+8]
+	link.Created = time.Now()
+
+	query := `INSERT INTO share_links (workspace_id, note_block_id, prefix, token_hash, created_by, created, expires)
+			  VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err = r.db.QueryRowContext(ctx, query,
+		link.WorkspaceID, link.NoteBlockID, link.Prefix, hashToken(link.Token),
+		link.CreatedBy, link.Created, link.Expires).Scan(&link.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return nil
+}
+
+func (r *shareRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.ShareLink, error) {
+	query := `SELECT id, workspace_id, note_block_id, prefix, created_by, created, expires, revoked
+			  FROM share_links WHERE workspace_id = ? ORDER BY id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []models.ShareLink
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, *link)
+	}
+
+	return links, nil
+}
+
+func (r *shareRepository) Revoke(ctx context.Context, workspaceID string, id int64) error {
+	query := `UPDATE share_links SET revoked = ? WHERE id = ? AND workspace_id = ? AND revoked IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("share link not found")
+	}
+
+	return nil
+}
+
+// Resolve looks up an active share link by its plaintext token. Revoked links
+// are reported as not found, expired links as expired.
+func (r *shareRepository) Resolve(ctx context.Context, token string) (*models.ShareLink, error) {
+	query := `SELECT id, workspace_id, note_block_id, prefix, created_by, created, expires, revoked
+			  FROM share_links WHERE token_hash = ? AND revoked IS NULL`
+
+	link, err := scanShareLink(r.db.QueryRowContext(ctx, query, hashToken(token)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("share link not found")
+		}
+		return nil, fmt.Errorf("failed to resolve share link: %w", err)
+	}
+
+	if link.Expires != nil && time.Now().After(*link.Expires) {
+		return nil, fmt.Errorf("share link expired")
+	}
+
+	return link, nil
+}
+
+func scanShareLink(row rowScanner) (*models.ShareLink, error) {
+	link := &models.ShareLink{}
+	var noteBlockID sql.NullInt64
+	var expires, revoked sql.NullTime
+
+	err := row.Scan(
+		&link.ID, &link.WorkspaceID, &noteBlockID, &link.Prefix,
+		&link.CreatedBy, &link.Created, &expires, &revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable columns
+	if noteBlockID.Valid {
+		link.NoteBlockID = &noteBlockID.Int64
+	}
+	if expires.Valid {
+		link.Expires = &expires.Time
+	}
+	if revoked.Valid {
+		link.Revoked = &revoked.Time
+	}
+
+	return link, nil
+}
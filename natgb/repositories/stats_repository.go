@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+const dayFormat = "2006-01-02"
+
+type statsRepository struct {
+	db *sql.DB
+}
+
+func NewStatsRepository(db *sql.DB) StatsRepository {
+	return &statsRepository{db: db}
+}
+
+// GetWorkspaceStats computes completion counts per note block and priority,
+// plus notes created and completed per day within the window and the average
+// time from creation to completion of the notes completed in it. Days are
+// bucketed in server local time.
+func (r *statsRepository) GetWorkspaceStats(ctx context.Context, workspaceID string, since, until time.Time) (*models.WorkspaceStats, error) {
+	stats := &models.WorkspaceStats{
+		WorkspaceID: workspaceID,
+		Since:       since,
+		Until:       until,
+		ByPriority:  map[string]models.CompletionCount{},
+		NoteBlocks:  []models.NoteBlockStats{},
+		Daily:       []models.DailyStats{},
+	}
+
+	if err := r.countNotes(ctx, stats); err != nil {
+		return nil, err
+	}
+	if err := r.collectTimeline(ctx, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (r *statsRepository) countNotes(ctx context.Context, stats *models.WorkspaceStats) error {
+	query := `SELECT nb.id, nb.head, COALESCE(n.priority, ''), COALESCE(n.metadata_completed, false), COUNT(n.id)
+			  FROM note_blocks nb LEFT JOIN notes n ON n.note_block_id = nb.id
+			  WHERE nb.workspace_id = ?
+			  GROUP BY nb.id, n.priority, n.metadata_completed ORDER BY nb.id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, stats.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to count notes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteBlockID int64
+		var head, priority string
+		var completed bool
+		var count int
+
+		if err := rows.Scan(&noteBlockID, &head, &priority, &completed, &count); err != nil {
+			return fmt.Errorf("failed to scan note counts: %w", err)
+		}
+
+		last := len(stats.NoteBlocks) - 1
+		if last < 0 || stats.NoteBlocks[last].NoteBlockID != noteBlockID {
+			stats.NoteBlocks = append(stats.NoteBlocks, models.NoteBlockStats{
+				NoteBlockID: noteBlockID,
+				Head:        head,
+				ByPriority:  map[string]models.CompletionCount{},
+			})
+			last++
+		}
+		if count == 0 {
+			continue // Empty note block
+		}
+
+		block := &stats.NoteBlocks[last]
+		block.ByPriority[priority] = addCount(block.ByPriority[priority], count, completed)
+		stats.ByPriority[priority] = addCount(stats.ByPriority[priority], count, completed)
+
+		block.Total += count
+		stats.Total += count
+		if completed {
+			block.Completed += count
+			stats.Completed += count
+		}
+	}
+
+	for i := range stats.NoteBlocks {
+		stats.NoteBlocks[i].CompletionPercentage = percentage(stats.NoteBlocks[i].Completed, stats.NoteBlocks[i].Total)
+	}
+	stats.CompletionPercentage = percentage(stats.Completed, stats.Total)
+
+	return nil
+}
+
+func (r *statsRepository) collectTimeline(ctx context.Context, stats *models.WorkspaceStats) error {
+	// Timestamps are stored as text in local time, so compare in local time
+	since, until := stats.Since.Local(), stats.Until.Local()
+
+	days := map[string]*models.DailyStats{}
+	for day := startOfDay(since); day.Before(until); day = day.AddDate(0, 0, 1) {
+		stats.Daily = append(stats.Daily, models.DailyStats{Date: day.Format(dayFormat)})
+	}
+	for i := range stats.Daily {
+		days[stats.Daily[i].Date] = &stats.Daily[i]
+	}
+
+	query := `SELECT n.metadata_created, n.metadata_completed_at
+			  FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id
+			  WHERE nb.workspace_id = ?
+			  AND ((n.metadata_created >= ? AND n.metadata_created < ?)
+			  OR (n.metadata_completed_at >= ? AND n.metadata_completed_at < ?))`
+
+	rows, err := r.db.QueryContext(ctx, query, stats.WorkspaceID, since, until, since, until)
+	if err != nil {
+		return fmt.Errorf("failed to get note timeline: %w", err)
+	}
+	defer rows.Close()
+
+	var completedCount int
+	var totalDuration time.Duration
+
+	for rows.Next() {
+		var created time.Time
+		var completedAt sql.NullTime
+
+		if err := rows.Scan(&created, &completedAt); err != nil {
+			return fmt.Errorf("failed to scan note timeline: %w", err)
+		}
+
+		if inWindow(created, since, until) {
+			if day, ok := days[created.Local().Format(dayFormat)]; ok {
+				day.Created++
+			}
+		}
+
+		if completedAt.Valid && inWindow(completedAt.Time, since, until) {
+			if day, ok := days[completedAt.Time.Local().Format(dayFormat)]; ok {
+				day.Completed++
+			}
+			if completedAt.Time.After(created) {
+				totalDuration += completedAt.Time.Sub(created)
+			}
+			completedCount++
+		}
+	}
+
+	if completedCount > 0 {
+		average := totalDuration.Seconds() / float64(completedCount)
+		stats.AverageCompletionSeconds = &average
+	}
+
+	return nil
+}
+
+func addCount(count models.CompletionCount, n int, completed bool) models.CompletionCount {
+	count.Total += n
+	if completed {
+		count.Completed += n
+	}
+	return count
+}
+
+// percentage returns part of total as a percentage rounded to two decimals.
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func inWindow(t, since, until time.Time) bool {
+	return !t.Before(since) && t.Before(until)
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type statusRepository struct {
+	db *sql.DB
+}
+
+func NewStatusRepository(db *sql.DB) StatusRepository {
+	return &statusRepository{db: db}
+}
+
+func (r *statusRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.NoteStatus, error) {
+	query := `SELECT key, name, position, terminal FROM workspace_statuses
+			  WHERE workspace_id = ? ORDER BY position ASC, key ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statuses: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := []models.NoteStatus{}
+	for rows.Next() {
+		var status models.NoteStatus
+		if err := rows.Scan(&status.Key, &status.Name, &status.Position, &status.Terminal); err != nil {
+			return nil, fmt.Errorf("failed to scan status: %w", err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Replace sets the statuses of a workspace. Statuses still used by notes
+// cannot be removed, and notes follow changes of the terminal flag.
+func (r *statusRepository) Replace(ctx context.Context, workspaceID string, statuses []models.NoteStatus) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		keys := map[string]bool{}
+		for _, status := range statuses {
+			keys[status.Key] = true
+		}
+
+		query := `SELECT DISTINCT n.status FROM notes n JOIN note_blocks nb ON nb.id = n.note_block_id
+				  WHERE nb.workspace_id = ? ORDER BY n.status ASC`
+
+		rows, err := conn(ctx, r.db).QueryContext(ctx, query, workspaceID)
+		if err != nil {
+			return fmt.Errorf("failed to get used statuses: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return fmt.Errorf("failed to scan used status: %w", err)
+			}
+			if !keys[key] {
+				return fmt.Errorf("status in use: %s", key)
+			}
+		}
+		rows.Close()
+
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM workspace_statuses WHERE workspace_id = ?`, workspaceID); err != nil {
+			return fmt.Errorf("failed to delete statuses: %w", err)
+		}
+		if err := insertStatuses(ctx, conn(ctx, r.db), workspaceID, statuses); err != nil {
+			return err
+		}
+
+		return syncNoteStatuses(ctx, conn(ctx, r.db),
+			`note_block_id IN (SELECT id FROM note_blocks WHERE workspace_id = ?)`, workspaceID)
+	})
+}
+
+func insertStatuses(ctx context.Context, db dbtx, workspaceID string, statuses []models.NoteStatus) error {
+	query := `INSERT INTO workspace_statuses (workspace_id, key, name, position, terminal) VALUES (?, ?, ?, ?, ?)`
+
+	for _, status := range statuses {
+		if _, err := db.ExecContext(ctx, query, workspaceID, status.Key, status.Name, status.Position, status.Terminal); err != nil {
+			return fmt.Errorf("failed to create status: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// syncNoteStatuses keeps the completed flag of the notes matching condition
+// in line with their status. Notes whose status is empty or unknown to their
+// workspace get the first status whose terminal flag matches their completed
+// flag; the others take the completed flag of their status.
+func syncNoteStatuses(ctx context.Context, db dbtx, condition string, args ...interface{}) error {
+	assign := `UPDATE notes SET status = COALESCE((
+				SELECT s.key FROM workspace_statuses s JOIN note_blocks nb ON nb.workspace_id = s.workspace_id
+				WHERE nb.id = notes.note_block_id AND s.terminal = notes.metadata_completed
+				ORDER BY s.position ASC, s.key ASC LIMIT 1), status)
+			   WHERE (` + condition + `) AND NOT EXISTS (
+				SELECT 1 FROM workspace_statuses s JOIN note_blocks nb ON nb.workspace_id = s.workspace_id
+				WHERE nb.id = notes.note_block_id AND s.key = notes.status)`
+
+	if _, err := db.ExecContext(ctx, assign, args...); err != nil {
+		return fmt.Errorf("failed to assign note statuses: %w", err)
+	}
+
+	// Assignments see the old row, so the completion time is set when completing
+	derive := `UPDATE notes SET metadata_completed = NOT metadata_completed,
+			   metadata_completed_at = CASE WHEN metadata_completed THEN NULL ELSE ? END
+			   WHERE (` + condition + `) AND metadata_completed != (
+				SELECT s.terminal FROM workspace_statuses s JOIN note_blocks nb ON nb.workspace_id = s.workspace_id
+				WHERE nb.id = notes.note_block_id AND s.key = notes.status)`
+
+	if _, err := db.ExecContext(ctx, derive, append([]interface{}{time.Now()}, args...)...); err != nil {
+		return fmt.Errorf("failed to derive note completion: %w", err)
+	}
+
+	return nil
+}
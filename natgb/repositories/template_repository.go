@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type templateRepository struct {
+	db *sql.DB
+}
+
+func NewTemplateRepository(db *sql.DB) TemplateRepository {
+	return &templateRepository{db: db}
+}
+
+func (r *templateRepository) Create(ctx context.Context, template *models.WorkspaceTemplate) error {
+	template.Created = time.Now()
+	if template.NoteBlocks == nil {
+		template.NoteBlocks = []models.NoteBlock{}
+	}
+
+	// The structure is stored as JSON, since templates are only read as a whole
+	noteBlocks, err := json.Marshal(template.NoteBlocks)
+	if err != nil {
+		return fmt.Errorf("failed to encode template note blocks: %w", err)
+	}
+
+	query := `INSERT INTO templates (user_id, name, description, title, include_notes, note_blocks, created)
+			  VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err = r.db.QueryRowContext(ctx, query,
+		template.UserID, template.Name, template.Description, template.Title,
+		template.IncludeNotes, string(noteBlocks), template.Created).Scan(&template.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+
+	return nil
+}
+
+func (r *templateRepository) GetByID(ctx context.Context, id int64) (*models.WorkspaceTemplate, error) {
+	query := `SELECT id, user_id, name, description, title, include_notes, note_blocks, created
+			  FROM templates WHERE id = ?`
+
+	template, err := scanTemplate(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("template not found")
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	return template, nil
+}
+
+func (r *templateRepository) GetByUserID(ctx context.Context, userID string) ([]models.WorkspaceTemplate, error) {
+	query := `SELECT id, user_id, name, description, title, include_notes, note_blocks, created
+			  FROM templates WHERE user_id = ? ORDER BY name ASC, id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.WorkspaceTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, *template)
+	}
+
+	return templates, nil
+}
+
+func (r *templateRepository) Delete(ctx context.Context, userID string, id int64) error {
+	query := `DELETE FROM templates WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("template not found")
+	}
+
+	return nil
+}
+
+func scanTemplate(row rowScanner) (*models.WorkspaceTemplate, error) {
+	template := &models.WorkspaceTemplate{}
+	var noteBlocks string
+
+	err := row.Scan(
+		&template.ID, &template.UserID, &template.Name, &template.Description,
+		&template.Title, &template.IncludeNotes, &noteBlocks, &template.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(noteBlocks), &template.NoteBlocks); err != nil {
+		return nil, fmt.Errorf("failed to decode template note blocks: %w", err)
+	}
+
+	return template, nil
+}
@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+// tokenPrefix marks personal access tokens so they are easy to recognise in
+// scripts and secret scanners.
+const tokenPrefix = "nat_"
+
+type tokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+// generateSecret returns prefix followed by 256 random bits, hex encoded.
+func generateSecret(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(secret), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token. Tokens carry 256 bits
+// of randomness, so a fast unsalted hash is sufficient here.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create generates a new secret for the token, stores its hash and sets the
+// plaintext on token.Token so it can be shown to the caller once.
+func (r *tokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	return insertToken(ctx, conn(ctx, r.db), token)
+}
+
+// insertToken issues a token with whatever transaction db is, so that new
+// users are created together with their first token.
+func insertToken(ctx context.Context, db dbtx, token *models.APIToken) error {
+	plaintext, err := generateSecret(tokenPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	token.Token = plaintext
+	token.Prefix = token.Token[:len(tokenPrefix)+8]
+	token.Created = time.Now()
+
+	query := `INSERT INTO api_tokens (user_id, name, prefix, token_hash, read_only, workspace_id, created)
+			  VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err = db.QueryRowContext(ctx, query,
+		token.UserID, token.Name, token.Prefix, hashToken(token.Token),
+		token.ReadOnly, token.WorkspaceID, token.Created).Scan(&token.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) GetByID(ctx context.Context, id int64) (*models.APIToken, error) {
+	query := `SELECT id, user_id, name, prefix, read_only, workspace_id, created, last_used, revoked
+			  FROM api_tokens WHERE id = ?`
+
+	token, err := scanToken(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("token not found")
+		}
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]models.APIToken, error) {
+	query := `SELECT id, user_id, name, prefix, read_only, workspace_id, created, last_used, revoked
+			  FROM api_tokens WHERE user_id = ? ORDER BY id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, nil
+}
+
+func (r *tokenRepository) Rename(ctx context.Context, id int64, name string) error {
+	query := `UPDATE api_tokens SET name = ? WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("token not found")
+	}
+
+	return nil
+}
+
+// Revoke marks a token as revoked. Revoked tokens are kept so they still show
+// up in listings, but they can no longer authenticate.
+func (r *tokenRepository) Revoke(ctx context.Context, id int64) error {
+	query := `UPDATE api_tokens SET revoked = ? WHERE id = ? AND revoked IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("token not found")
+	}
+
+	return nil
+}
+
+// Authenticate looks up an active token by its plaintext value and records
+// the time it was used.
+func (r *tokenRepository) Authenticate(ctx context.Context, plaintext string) (*models.APIToken, error) {
+	query := `SELECT id, user_id, name, prefix, read_only, workspace_id, created, last_used, revoked
+			  FROM api_tokens WHERE token_hash = ? AND revoked IS NULL`
+
+	token, err := scanToken(r.db.QueryRowContext(ctx, query, hashToken(plaintext)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("token not found")
+		}
+		return nil, fmt.Errorf("failed to authenticate token: %w", err)
+	}
+
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used = ? WHERE id = ?`, now, token.ID); err != nil {
+		return nil, fmt.Errorf("failed to update token usage: %w", err)
+	}
+	token.LastUsed = &now
+
+	return token, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row rowScanner) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	var workspaceID sql.NullString
+	var lastUsed, revoked sql.NullTime
+
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.ReadOnly,
+		&workspaceID, &token.Created, &lastUsed, &revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable columns
+	if workspaceID.Valid {
+		token.WorkspaceID = &workspaceID.String
+	}
+	if lastUsed.Valid {
+		token.LastUsed = &lastUsed.Time
+	}
+	if revoked.Valid {
+		token.Revoked = &revoked.Time
+	}
+
+	return token, nil
+}
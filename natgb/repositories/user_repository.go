@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type userRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+// Create registers a user under a generated ID together with its first
+// token, so that no account is left without a way to log in.
+func (r *userRepository) Create(ctx context.Context, user *models.User, token *models.APIToken) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate user id: %w", err)
+	}
+	user.ID = "user_" + hex.EncodeToString(suffix)
+	user.Created = time.Now()
+
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO users (id, name, created) VALUES (?, ?, ?)`
+
+		db := conn(ctx, r.db)
+		if _, err := db.ExecContext(ctx, query, user.ID, user.Name, user.Created); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		token.UserID = user.ID
+		return insertToken(ctx, db, token)
+	})
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	query := `SELECT id, name, created FROM users WHERE id = ?`
+
+	user := &models.User{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Created)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,261 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	webhook.Created = time.Now()
+
+	query := `INSERT INTO webhooks (workspace_id, url, events, secret, active, created)
+			  VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err := r.db.QueryRowContext(ctx, query,
+		webhook.WorkspaceID, webhook.URL, strings.Join(webhook.Events, ","),
+		webhook.Secret, webhook.Active, webhook.Created).Scan(&webhook.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id int64) (*models.Webhook, error) {
+	query := `SELECT id, workspace_id, url, events, secret, active, created FROM webhooks WHERE id = ?`
+
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (r *webhookRepository) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]models.Webhook, error) {
+	query := `SELECT id, workspace_id, url, events, secret, active, created
+			  FROM webhooks WHERE workspace_id = ? ORDER BY id ASC`
+
+	return r.getWebhooksByCondition(ctx, query, workspaceID)
+}
+
+// GetSubscribed returns the active webhooks of a workspace that subscribe to
+// the event, either by name or through the "*" wildcard.
+func (r *webhookRepository) GetSubscribed(ctx context.Context, workspaceID, event string) ([]models.Webhook, error) {
+	query := `SELECT id, workspace_id, url, events, secret, active, created
+			  FROM webhooks WHERE workspace_id = ? AND active = true ORDER BY id ASC`
+
+	webhooks, err := r.getWebhooksByCondition(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscribed []models.Webhook
+	for _, webhook := range webhooks {
+		for _, subscribedEvent := range webhook.Events {
+			if subscribedEvent == event || subscribedEvent == models.EventAll {
+				subscribed = append(subscribed, webhook)
+				break
+			}
+		}
+	}
+
+	return subscribed, nil
+}
+
+func (r *webhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	query := `UPDATE webhooks SET url = ?, events = ?, active = ? WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		webhook.URL, strings.Join(webhook.Events, ","), webhook.Active, webhook.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Created = time.Now()
+	if delivery.Status == "" {
+		delivery.Status = models.DeliveryPending
+	}
+	if delivery.NextAttempt == nil {
+		delivery.NextAttempt = &delivery.Created
+	}
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt, created)
+			  VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+
+	err := r.db.QueryRowContext(ctx, query,
+		delivery.WebhookID, delivery.Event, string(delivery.Payload),
+		delivery.Status, delivery.NextAttempt, delivery.Created).Scan(&delivery.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the delivery history of a webhook, newest first.
+func (r *webhookRepository) GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt, created, delivered
+			  FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+
+	return r.getDeliveriesByCondition(ctx, query, webhookID, limit)
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due,
+// oldest first.
+func (r *webhookRepository) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt, created, delivered
+			  FROM webhook_deliveries WHERE status = 'pending' AND next_attempt <= ? ORDER BY next_attempt ASC, id ASC LIMIT ?`
+
+	return r.getDeliveriesByCondition(ctx, query, now, limit)
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt = ?, delivered = ?
+			  WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.Error,
+		delivery.NextAttempt, delivery.Delivered, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("webhook delivery not found")
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) getWebhooksByCondition(ctx context.Context, query string, args ...interface{}) ([]models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepository) getDeliveriesByCondition(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload string
+		var responseCode sql.NullInt64
+		var nextAttempt, delivered sql.NullTime
+
+		err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status,
+			&delivery.Attempts, &responseCode, &delivery.Error, &nextAttempt, &delivery.Created, &delivered,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+
+		// Handle nullable columns
+		delivery.Payload = []byte(payload)
+		if responseCode.Valid {
+			code := int(responseCode.Int64)
+			delivery.ResponseCode = &code
+		}
+		if nextAttempt.Valid {
+			delivery.NextAttempt = &nextAttempt.Time
+		}
+		if delivered.Valid {
+			delivery.Delivered = &delivered.Time
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	var events string
+
+	err := row.Scan(
+		&webhook.ID, &webhook.WorkspaceID, &webhook.URL, &events,
+		&webhook.Secret, &webhook.Active, &webhook.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Events = strings.Split(events, ",")
+	return webhook, nil
+}
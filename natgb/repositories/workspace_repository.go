@@ -2,7 +2,9 @@ package repositories
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -23,7 +25,18 @@ func NewWorkspaceRepository(db *sql.DB, noteBlockRepo NoteBlockRepository, noteR
 	}
 }
 
-func (r *workspaceRepository) Create(ctx context.Context, workspace *models.Workspace) error {
+// Create creates a workspace with its note blocks and notes and, unless
+// ownerID is empty, makes that user its owner, all or none.
+func (r *workspaceRepository) Create(ctx context.Context, workspace *models.Workspace, ownerID string) error {
+	// Generate an ID if not provided
+	if workspace.ID == "" {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return fmt.Errorf("failed to generate workspace id: %w", err)
+		}
+		workspace.ID = "workspace_" + hex.EncodeToString(suffix)
+	}
+
 	now := time.Now()
 	workspace.Created = now
 	workspace.LastModified = now
@@ -35,22 +48,153 @@ func (r *workspaceRepository) Create(ctx context.Context, workspace *models.Work
 		workspace.Data.AppConfig.Metadata.Updated = now
 	}
 
-	query := `INSERT INTO workspaces (id, name, created, last_modified, app_config_title, app_config_created, app_config_updated) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?)`
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		query := `INSERT INTO workspaces (id, name, created, last_modified, app_config_title, app_config_created, app_config_updated) 
+				  VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := r.db.ExecContext(ctx, query,
-		workspace.ID, workspace.Name, workspace.Created, workspace.LastModified,
-		workspace.Data.AppConfig.Title, workspace.Data.AppConfig.Metadata.Created, workspace.Data.AppConfig.Metadata.Updated)
+		_, err := conn(ctx, r.db).ExecContext(ctx, query,
+			workspace.ID, workspace.Name, workspace.Created, workspace.LastModified,
+			workspace.Data.AppConfig.Title, workspace.Data.AppConfig.Metadata.Created, workspace.Data.AppConfig.Metadata.Updated)
 
-	if err != nil {
-		return fmt.Errorf("failed to create workspace: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+
+		if err := insertStatuses(ctx, conn(ctx, r.db), workspace.ID, models.DefaultNoteStatuses); err != nil {
+			return err
+		}
+		if err := insertPriorities(ctx, conn(ctx, r.db), workspace.ID, models.DefaultNotePriorities); err != nil {
+			return err
+		}
+
+		if ownerID != "" {
+			owner := models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: ownerID, Role: models.RoleOwner}
+			if err := insertMember(ctx, conn(ctx, r.db), &owner); err != nil {
+				return err
+			}
+		}
+
+		return r.createNoteBlocks(ctx, workspace.ID, ownerID, workspace.Data.NoteBlocks)
+	})
+}
+
+// AddNoteBlocks creates note blocks with their notes in an existing
+// workspace, all or none.
+func (r *workspaceRepository) AddNoteBlocks(ctx context.Context, workspaceID string, noteBlocks []models.NoteBlock) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := r.GetByID(ctx, workspaceID); err != nil {
+			return err
+		}
+		return r.createNoteBlocks(ctx, workspaceID, "", noteBlocks)
+	})
+}
 
-	// Create note blocks if provided
-	for _, noteBlock := range workspace.Data.NoteBlocks {
-		if err := r.noteBlockRepo.Create(ctx, &noteBlock, workspace.ID); err != nil {
+// AddNotes adds notes to the note blocks of a workspace, all or none. Note
+// blocks with an ID must belong to the workspace and only get the notes; the
+// others are created with them. Notes added to existing note blocks carry no
+// comments, attachments or dependencies.
+func (r *workspaceRepository) AddNotes(ctx context.Context, workspaceID string, noteBlocks []models.NoteBlock) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := r.GetByID(ctx, workspaceID); err != nil {
+			return err
+		}
+
+		for i := range noteBlocks {
+			noteBlock := &noteBlocks[i]
+			if noteBlock.ID == 0 {
+				if err := r.createNoteBlocks(ctx, workspaceID, "", noteBlocks[i:i+1]); err != nil {
+					return err
+				}
+				continue
+			}
+
+			owner, err := r.noteBlockRepo.GetWorkspaceID(ctx, noteBlock.ID)
+			if err != nil {
+				return err
+			}
+			if owner != workspaceID {
+				return fmt.Errorf("note block not found")
+			}
+			for j := range noteBlock.Notes {
+				if err := r.noteRepo.Create(ctx, &noteBlock.Notes[j], noteBlock.ID); err != nil {
+					return fmt.Errorf("failed to create note: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreNoteBlock recreates a deleted note block and its notes under their
+// own IDs, all or none.
+func (r *workspaceRepository) RestoreNoteBlock(ctx context.Context, workspaceID string, noteBlock *models.NoteBlock) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		if err := r.noteBlockRepo.Create(ctx, noteBlock, workspaceID); err != nil {
+			return err
+		}
+		for i := range noteBlock.Notes {
+			if err := r.noteRepo.Restore(ctx, &noteBlock.Notes[i], noteBlock.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createNoteBlocks creates note blocks and their notes, with the comments
+// and attachments they carry, on behalf of importerID. Dependencies are kept
+// between the new notes, by the IDs the notes were given.
+func (r *workspaceRepository) createNoteBlocks(ctx context.Context, workspaceID, importerID string, noteBlocks []models.NoteBlock) error {
+	now := time.Now()
+	ids := make(map[int64]int64)
+	var notes []*models.Note
+	var err error
+	for i := range noteBlocks {
+		noteBlock := &noteBlocks[i]
+		if err := r.noteBlockRepo.Create(ctx, noteBlock, workspaceID); err != nil {
 			return fmt.Errorf("failed to create note block: %w", err)
 		}
+
+		for j := range noteBlock.Notes {
+			note := &noteBlock.Notes[j]
+			oldID := note.ID
+			if err := r.noteRepo.Create(ctx, note, noteBlock.ID); err != nil {
+				return fmt.Errorf("failed to create note: %w", err)
+			}
+			if oldID != 0 {
+				ids[oldID] = note.ID
+			}
+			notes = append(notes, note)
+
+			if err := insertComments(ctx, conn(ctx, r.db), note.ID, nil, importerID, note.Comments); err != nil {
+				return err
+			}
+			note.CommentCount = 0
+			note.Comments = nil
+			// Attachments come along only with content already stored, as
+			// archive imports do; JSON cannot carry it
+			if note.Attachments, err = insertAttachments(ctx, conn(ctx, r.db), note.ID, importerID, note.Attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Dependencies on notes outside the workspace are dropped
+	for _, note := range notes {
+		var blockedBy []int64
+		for _, oldID := range note.BlockedBy {
+			dependsOnID, ok := ids[oldID]
+			if !ok {
+				continue
+			}
+			query := `INSERT OR IGNORE INTO note_dependencies (note_id, depends_on_id, created) VALUES (?, ?, ?)`
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, note.ID, dependsOnID, now); err != nil {
+				return fmt.Errorf("failed to create note dependency: %w", err)
+			}
+			blockedBy = append(blockedBy, dependsOnID)
+		}
+		note.BlockedBy = blockedBy
+		note.Blocks = nil
 	}
 
 	return nil
@@ -63,7 +207,7 @@ func (r *workspaceRepository) GetByID(ctx context.Context, id string) (*models.W
 	workspace := &models.Workspace{}
 	var appConfigCreated, appConfigUpdated sql.NullTime
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
 		&workspace.ID, &workspace.Name, &workspace.Created, &workspace.LastModified,
 		&workspace.Data.AppConfig.Title, &appConfigCreated, &appConfigUpdated,
 	)
@@ -90,7 +234,19 @@ func (r *workspaceRepository) GetAll(ctx context.Context) ([]models.Workspace, e
 	query := `SELECT id, name, created, last_modified, app_config_title, app_config_created, app_config_updated 
 			  FROM workspaces ORDER BY created ASC`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	return r.getWorkspacesByCondition(ctx, query)
+}
+
+func (r *workspaceRepository) GetByUserID(ctx context.Context, userID string) ([]models.Workspace, error) {
+	query := `SELECT w.id, w.name, w.created, w.last_modified, w.app_config_title, w.app_config_created, w.app_config_updated 
+			  FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+			  WHERE m.user_id = ? ORDER BY w.created ASC`
+
+	return r.getWorkspacesByCondition(ctx, query, userID)
+}
+
+func (r *workspaceRepository) getWorkspacesByCondition(ctx context.Context, query string, args ...interface{}) ([]models.Workspace, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workspaces: %w", err)
 	}
@@ -130,7 +286,7 @@ func (r *workspaceRepository) Update(ctx context.Context, workspace *models.Work
 	query := `UPDATE workspaces SET name = ?, last_modified = ?, app_config_title = ?, app_config_updated = ? 
 			  WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		workspace.Name, workspace.LastModified,
 		workspace.Data.AppConfig.Title, workspace.Data.AppConfig.Metadata.Updated,
 		workspace.ID)
@@ -154,7 +310,7 @@ func (r *workspaceRepository) Update(ctx context.Context, workspace *models.Work
 func (r *workspaceRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM workspaces WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete workspace: %w", err)
 	}
@@ -197,20 +353,79 @@ func (r *workspaceRepository) GetWithFullHierarchy(ctx context.Context, id strin
 	return workspace, nil
 }
 
-func (r *workspaceRepository) ImportWorkspaces(ctx context.Context, workspaces []models.Workspace) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
+// ImportWorkspaces creates workspaces owned by ownerID, all or none.
+func (r *workspaceRepository) ImportWorkspaces(ctx context.Context, workspaces []models.Workspace, ownerID string) error {
+	return inTx(ctx, r.db, func(ctx context.Context) error {
+		for i := range workspaces {
+			if err := r.Create(ctx, &workspaces[i], ownerID); err != nil {
+				return fmt.Errorf("failed to import workspace %s: %w", workspaces[i].ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Duplicate copies a workspace with all note blocks and notes under new IDs
+// in a single transaction, owned by ownerID. An empty name defaults to the
+// source name with a " (copy)" suffix; resetCompletion marks every copied
+// note as pending.
+func (r *workspaceRepository) Duplicate(ctx context.Context, id, newID, name, ownerID string, resetCompletion bool) (*models.Workspace, error) {
+	var workspace models.Workspace
+
+	err := inTx(ctx, r.db, func(ctx context.Context) error {
+		source, err := r.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		workspace.ID = newID
+		workspace.Name = name
+		if workspace.Name == "" {
+			workspace.Name = source.Name + " (copy)"
+		}
+		workspace.Data.AppConfig.Title = source.Data.AppConfig.Title
+		workspace.Data.AppConfig.Metadata = models.Metadata{Created: time.Now(), Updated: time.Now()}
+
+		if err := r.Create(ctx, &workspace, ownerID); err != nil {
+			return err
+		}
+
+		// The copy keeps the workflow and priorities, so that the notes keep
+		// their statuses and priorities
+		settings := []struct{ table, columns string }{
+			{"workspace_statuses", "key, name, position, terminal"},
+			{"workspace_priorities", "name, rank, color"},
+		}
+		for _, setting := range settings {
+			query := fmt.Sprintf(`DELETE FROM %s WHERE workspace_id = ?`, setting.table)
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, workspace.ID); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", setting.table, err)
+			}
+
+			query = fmt.Sprintf(`INSERT INTO %[1]s (workspace_id, %[2]s) SELECT ?, %[2]s FROM %[1]s WHERE workspace_id = ?`,
+				setting.table, setting.columns)
+			if _, err := conn(ctx, r.db).ExecContext(ctx, query, workspace.ID, id); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", setting.table, err)
+			}
+		}
 
-	for _, workspace := range workspaces {
-		if err := r.Create(ctx, &workspace); err != nil {
-			return fmt.Errorf("failed to import workspace %s: %w", workspace.ID, err)
+		noteBlocks, err := r.noteBlockRepo.GetByWorkspaceID(ctx, id)
+		if err != nil {
+			return err
 		}
+		for _, noteBlock := range noteBlocks {
+			if _, err := r.noteBlockRepo.Duplicate(ctx, noteBlock.ID, workspace.ID, "", resetCompletion); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	return r.GetWithFullHierarchy(ctx, workspace.ID)
 }
 
 func (r *workspaceRepository) ExportAll(ctx context.Context) (*models.ExportData, error) {
@@ -219,6 +434,19 @@ func (r *workspaceRepository) ExportAll(ctx context.Context) (*models.ExportData
 		return nil, err
 	}
 
+	return r.export(ctx, workspaces)
+}
+
+func (r *workspaceRepository) ExportForUser(ctx context.Context, userID string) (*models.ExportData, error) {
+	workspaces, err := r.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.export(ctx, workspaces)
+}
+
+func (r *workspaceRepository) export(ctx context.Context, workspaces []models.Workspace) (*models.ExportData, error) {
 	// Load full hierarchy for each workspace
 	for i := range workspaces {
 		fullWorkspace, err := r.GetWithFullHierarchy(ctx, workspaces[i].ID)
@@ -226,6 +454,16 @@ func (r *workspaceRepository) ExportAll(ctx context.Context) (*models.ExportData
 			return nil, err
 		}
 		workspaces[i] = *fullWorkspace
+
+		// Exports carry the comment threads of each note
+		for j := range workspaces[i].Data.NoteBlocks {
+			notes := workspaces[i].Data.NoteBlocks[j].Notes
+			for k := range notes {
+				if notes[k].Comments, err = getCommentThreads(ctx, conn(ctx, r.db), notes[k].ID); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 
 	return &models.ExportData{
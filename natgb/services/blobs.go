@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore keeps the content of attachments under opaque keys. Keys are
+// made of lowercase letters and digits.
+type BlobStore interface {
+	// Put stores the content read from r under key and returns its size
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob; missing blobs are not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalBlobStore keeps blobs as files in a directory, spread over
+// subdirectories named after the first two characters of their keys.
+type LocalBlobStore struct {
+	Dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &LocalBlobStore{Dir: dir}, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if len(key) < 3 || strings.Trim(key, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, key[:2], key), nil
+}
+
+// Put writes to a temporary file first, so that readers never see a blob
+// partially written.
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), key+".tmp*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	size, err := io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return size, nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("blob not found")
+		}
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return file, nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+)
+
+const dayFormat = "2006-01-02"
+
+// BuildFlowReport replays the note events of a workspace, oldest first, and
+// samples the number of open and done notes at the end of every day from
+// "from" through "to" (both local dates). The burndown's ideal line runs from
+// the open notes at the start of "from" to zero at the end of "to".
+func BuildFlowReport(workspaceID string, events []models.NoteEvent, from, to time.Time) *models.FlowReport {
+	report := &models.FlowReport{
+		WorkspaceID:    workspaceID,
+		From:           from.Format(dayFormat),
+		To:             to.Format(dayFormat),
+		CumulativeFlow: []models.FlowPoint{},
+		Burndown:       []models.BurndownPoint{},
+	}
+
+	// State of every note that exists: true when done
+	done := map[int64]bool{}
+	open, completed := 0, 0
+
+	apply := func(event models.NoteEvent) {
+		wasDone, exists := done[event.NoteID]
+
+		switch event.Event {
+		case models.NoteEventCreated:
+			if exists {
+				return
+			}
+			done[event.NoteID] = false
+			open++
+		case models.NoteEventCompleted:
+			if !exists || wasDone {
+				return
+			}
+			done[event.NoteID] = true
+			open--
+			completed++
+		case models.NoteEventReopened:
+			if !exists || !wasDone {
+				return
+			}
+			done[event.NoteID] = false
+			open++
+			completed--
+		case models.NoteEventDeleted:
+			if !exists {
+				return
+			}
+			delete(done, event.NoteID)
+			if wasDone {
+				completed--
+			} else {
+				open--
+			}
+		}
+	}
+
+	next := 0
+	for next < len(events) && events[next].Timestamp.Before(from) {
+		apply(events[next])
+		next++
+	}
+	startOpen := open
+
+	days := int(math.Round(to.Sub(from).Hours()/24)) + 1
+	for day := 0; day < days; day++ {
+		start := from.AddDate(0, 0, day)
+		end := start.AddDate(0, 0, 1)
+
+		point := models.FlowPoint{Date: start.Format(dayFormat)}
+		for next < len(events) && events[next].Timestamp.Before(end) {
+			switch events[next].Event {
+			case models.NoteEventCreated:
+				point.Created++
+			case models.NoteEventCompleted:
+				point.Completed++
+			case models.NoteEventReopened:
+				point.Reopened++
+			case models.NoteEventDeleted:
+				point.Deleted++
+			}
+			apply(events[next])
+			next++
+		}
+		point.Open, point.Done = open, completed
+		report.CumulativeFlow = append(report.CumulativeFlow, point)
+
+		ideal := float64(startOpen) * float64(days-day-1) / float64(days)
+		report.Burndown = append(report.Burndown, models.BurndownPoint{
+			Date:      point.Date,
+			Remaining: open,
+			Ideal:     math.Round(ideal*100) / 100,
+		})
+	}
+
+	return report
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanjeetsarkar/nat/models"
+	"github.com/tanjeetsarkar/nat/repositories"
+)
+
+// Headers sent with every webhook delivery
+const (
+	HeaderEvent     = "X-Nat-Event"
+	HeaderDelivery  = "X-Nat-Delivery"
+	HeaderSignature = "X-Nat-Signature" // "sha256=" + hex HMAC-SHA256 of the body
+)
+
+// WebhookDispatcher queues workspace events as deliveries and posts them to
+// subscribed webhooks from a background worker, retrying failed deliveries
+// with exponential backoff. Deliveries are persisted, so pending ones survive
+// restarts.
+type WebhookDispatcher struct {
+	Repo        repositories.WebhookRepository
+	Client      *http.Client
+	MaxAttempts int           // Attempts before a delivery is marked failed
+	BaseBackoff time.Duration // Delay before the first retry, doubled after every attempt
+	MaxBackoff  time.Duration
+	Interval    time.Duration // How often the worker looks for due deliveries
+
+	wake chan struct{}
+}
+
+func NewWebhookDispatcher(repo repositories.WebhookRepository) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Repo:        repo,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 6,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  1 * time.Hour,
+		Interval:    5 * time.Second,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Enqueue creates a pending delivery for every active webhook of the workspace
+// that subscribes to the event and wakes up the worker.
+func (d *WebhookDispatcher) Enqueue(ctx context.Context, workspaceID, event, actor string, data interface{}) error {
+	webhooks, err := d.Repo.GetSubscribed(ctx, workspaceID, event)
+	if err != nil {
+		return err
+	}
+
+	for i := range webhooks {
+		if _, err := d.enqueueDelivery(ctx, &webhooks[i], event, actor, data); err != nil {
+			return err
+		}
+	}
+
+	if len(webhooks) > 0 {
+		d.Wake()
+	}
+	return nil
+}
+
+// Ping queues a ping event for a single webhook, regardless of the events it
+// subscribes to, so that receivers can be tested.
+func (d *WebhookDispatcher) Ping(ctx context.Context, webhook *models.Webhook, actor string) (*models.WebhookDelivery, error) {
+	delivery, err := d.enqueueDelivery(ctx, webhook, models.EventPing, actor, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Wake()
+	return delivery, nil
+}
+
+func (d *WebhookDispatcher) enqueueDelivery(ctx context.Context, webhook *models.Webhook, event, actor string, data interface{}) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:       event,
+		WorkspaceID: webhook.WorkspaceID,
+		Actor:       actor,
+		Timestamp:   time.Now(),
+		Data:        data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	delivery := &models.WebhookDelivery{WebhookID: webhook.ID, Event: event, Payload: payload}
+	if err := d.Repo.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Wake makes the worker look for due deliveries without waiting for the next
+// interval.
+func (d *WebhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due webhooks until the context is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery that is currently due. Deliveries that
+// could not be moved on stay due, so a batch without any progress ends the
+// run until the next interval.
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) {
+	for {
+		deliveries, err := d.Repo.GetDueDeliveries(ctx, time.Now(), 50)
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		progress := false
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			if d.attempt(ctx, &deliveries[i]) {
+				progress = true
+			}
+		}
+		if !progress {
+			return
+		}
+	}
+}
+
+// attempt makes one attempt at a delivery and reports whether the delivery
+// was updated, which takes it off the due list until its next attempt.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) bool {
+	delivery.Attempts++
+	now := time.Now()
+
+	webhook, err := d.Repo.GetByID(ctx, delivery.WebhookID)
+	if err != nil {
+		log.Printf("webhooks: delivery %d: %v", delivery.ID, err)
+
+		// Deliveries of removed webhooks fail, others wait out the backoff
+		delivery.Error = err.Error()
+		if strings.Contains(err.Error(), "not found") || delivery.Attempts >= d.MaxAttempts {
+			delivery.Status = models.DeliveryFailed
+			delivery.NextAttempt = nil
+		} else {
+			next := now.Add(d.backoff(delivery.Attempts))
+			delivery.NextAttempt = &next
+		}
+		return d.update(ctx, delivery)
+	}
+
+	code, err := 0, fmt.Errorf("webhook is inactive")
+	if webhook.Active {
+		code, err = d.post(ctx, webhook, delivery)
+		now = time.Now()
+	}
+
+	if code != 0 {
+		delivery.ResponseCode = &code
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.Error = ""
+		delivery.Delivered = &now
+		delivery.NextAttempt = nil
+	case delivery.Attempts >= d.MaxAttempts || !webhook.Active:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttempt = nil
+	default:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttempt = &next
+	}
+
+	return d.update(ctx, delivery)
+}
+
+func (d *WebhookDispatcher) update(ctx context.Context, delivery *models.WebhookDelivery) bool {
+	if err := d.Repo.UpdateDelivery(ctx, delivery); err != nil {
+		log.Printf("webhooks: delivery %d: %v", delivery.ID, err)
+		return false
+	}
+	return true
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+// post sends a delivery and returns the response status code, if any. Any
+// status outside 2xx is an error.
+func (d *WebhookDispatcher) post(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nat-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a payload. Receivers recompute
+// it with their copy of the secret and compare in constant time.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}